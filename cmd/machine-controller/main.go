@@ -22,8 +22,10 @@ Modifications Copyright (c) 2017 SAP SE or an SAP affiliate company. All rights
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	_ "github.com/gardener/machine-controller-manager/pkg/util/client/metrics/prometheus" // for client metric registration
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/app"
@@ -32,6 +34,7 @@ import (
 	_ "github.com/gardener/machine-controller-manager/pkg/util/workqueue/prometheus" // for workqueue metric registration
 	cp "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal"
 	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/spi"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/tracing"
 	"github.com/spf13/pflag"
 	"k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/logs"
@@ -43,13 +46,46 @@ func main() {
 	klog.InitFlags(nil)
 	s.AddFlags(pflag.CommandLine)
 
+	providerOpts := cp.NewOptions()
+	providerOpts.AddFlags(pflag.CommandLine)
+
+	pluginSPI := &spi.PluginSPIImpl{RetryPolicy: spi.DefaultRetryPolicy()}
+	pluginSPI.RetryPolicy.AddFlags(pflag.CommandLine)
+
+	tracingOpts := tracing.NewOptions()
+	tracingOpts.AddFlags(pflag.CommandLine)
+
 	flag.InitFlags()
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
-	provider := cp.NewProvider(&spi.PluginSPIImpl{})
+	if err := providerOpts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if err := tracingOpts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracingOpts.Start(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	provider := cp.NewProvider(pluginSPI, providerOpts)
+
+	err = app.Run(s, provider)
+
+	// the remaining traces are flushed before exiting, as os.Exit skips deferred calls
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := shutdownTracing(ctx); err != nil {
+		klog.ErrorS(err, "unable to flush traces")
+	}
+	cancel()
 
-	if err := app.Run(s, provider); err != nil {
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,39 @@
+#!/usr/bin/env bash
+#
+# Generates deep-copy, conversion and defaulting functions of the provider spec api.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+CODEGEN_VERSION="v0.32.3"
+TOOLS_BIN_DIR="${TOOLS_BIN_DIR:-$(go env GOPATH)/bin}"
+
+ROOT="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+MODULE="github.com/metal-stack/machine-controller-manager-provider-metal"
+APIS="./pkg/metal/apis"
+HEADER="${ROOT}/hack/boilerplate.go.txt"
+
+for gen in deepcopy-gen conversion-gen defaulter-gen; do
+  if [[ ! -x "${TOOLS_BIN_DIR}/${gen}" ]]; then
+    GOBIN="${TOOLS_BIN_DIR}" go install "k8s.io/code-generator/cmd/${gen}@${CODEGEN_VERSION}"
+  fi
+done
+
+cd "${ROOT}"
+
+"${TOOLS_BIN_DIR}/deepcopy-gen" \
+  --go-header-file "${HEADER}" \
+  --output-file zz_generated.deepcopy.go \
+  "${APIS}" "${APIS}/v1alpha1" "${APIS}/v1alpha2"
+
+"${TOOLS_BIN_DIR}/defaulter-gen" \
+  --go-header-file "${HEADER}" \
+  --output-file zz_generated.defaults.go \
+  "${APIS}/v1alpha1" "${APIS}/v1alpha2"
+
+"${TOOLS_BIN_DIR}/conversion-gen" \
+  --go-header-file "${HEADER}" \
+  --output-file zz_generated.conversion.go \
+  --extra-peer-dirs "${MODULE}/pkg/metal/apis,k8s.io/apimachinery/pkg/apis/meta/v1,k8s.io/apimachinery/pkg/conversion,k8s.io/apimachinery/pkg/runtime" \
+  "${APIS}/v1alpha1" "${APIS}/v1alpha2"
@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package
+// +groupName=machine.metal-stack.io
+
+// Package apis is the internal version of the provider spec api, all versions are converted to it on decoding
+package apis
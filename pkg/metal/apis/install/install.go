@@ -0,0 +1,18 @@
+// Package install registers all versions of the provider spec api
+package install
+
+import (
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis/v1alpha1"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis/v1alpha2"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// Install registers the internal and all versioned provider spec types, conversions and defaults in the given scheme
+func Install(scheme *runtime.Scheme) {
+	utilruntime.Must(api.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1alpha2.AddToScheme(scheme))
+	utilruntime.Must(scheme.SetVersionPriority(v1alpha2.SchemeGroupVersion, v1alpha1.SchemeGroupVersion))
+}
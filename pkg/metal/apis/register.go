@@ -0,0 +1,30 @@
+package apis
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the api group of the provider spec
+	GroupName = "machine.metal-stack.io"
+	// Kind is the kind of the provider spec
+	Kind = "MetalProviderSpec"
+)
+
+var (
+	// SchemeGroupVersion is the internal group version of the provider spec
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: runtime.APIVersionInternal}
+
+	// SchemeBuilder is used to add the internal types to a scheme
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme adds the internal types to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&MetalProviderSpec{},
+	)
+	return nil
+}
@@ -0,0 +1,17 @@
+package v1alpha1
+
+import (
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func addDefaultingFuncs(scheme *runtime.Scheme) error {
+	return RegisterDefaults(scheme)
+}
+
+// SetDefaults_Network enables autoacquire of networks without static ip addresses and disables it for networks with static ip addresses
+func SetDefaults_Network(n *Network) {
+	if n.Autoacquire == nil {
+		n.Autoacquire = pointer.Pointer(len(n.IPs) == 0)
+	}
+}
@@ -0,0 +1,7 @@
+// +k8s:deepcopy-gen=package
+// +k8s:conversion-gen=github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=machine.metal-stack.io
+
+// Package v1alpha1 is the initial version of the provider spec api, a provider spec without apiVersion is decoded as v1alpha1
+package v1alpha1
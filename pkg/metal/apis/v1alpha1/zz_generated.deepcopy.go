@@ -0,0 +1,181 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright (c) 2026 SAP SE or an SAP affiliate company. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by deepcopy-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSServer) DeepCopyInto(out *DNSServer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSServer.
+func (in *DNSServer) DeepCopy() *DNSServer {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalProviderSpec) DeepCopyInto(out *MetalProviderSpec) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]Network, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SSHKeys != nil {
+		in, out := &in.SSHKeys, &out.SSHKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNSServers != nil {
+		in, out := &in.DNSServers, &out.DNSServers
+		*out = make([]DNSServer, len(*in))
+		copy(*out, *in)
+	}
+	if in.NTPServers != nil {
+		in, out := &in.NTPServers, &out.NTPServers
+		*out = make([]NTPServer, len(*in))
+		copy(*out, *in)
+	}
+	if in.MachineIDs != nil {
+		in, out := &in.MachineIDs, &out.MachineIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FallbackSizes != nil {
+		in, out := &in.FallbackSizes, &out.FallbackSizes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FallbackPartitions != nil {
+		in, out := &in.FallbackPartitions, &out.FallbackPartitions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FallbackNetworks != nil {
+		in, out := &in.FallbackNetworks, &out.FallbackNetworks
+		*out = make([]PartitionNetworks, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalProviderSpec.
+func (in *MetalProviderSpec) DeepCopy() *MetalProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetalProviderSpec) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NTPServer) DeepCopyInto(out *NTPServer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NTPServer.
+func (in *NTPServer) DeepCopy() *NTPServer {
+	if in == nil {
+		return nil
+	}
+	out := new(NTPServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Network) DeepCopyInto(out *Network) {
+	*out = *in
+	if in.Autoacquire != nil {
+		in, out := &in.Autoacquire, &out.Autoacquire
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Network.
+func (in *Network) DeepCopy() *Network {
+	if in == nil {
+		return nil
+	}
+	out := new(Network)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PartitionNetworks) DeepCopyInto(out *PartitionNetworks) {
+	*out = *in
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]Network, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PartitionNetworks.
+func (in *PartitionNetworks) DeepCopy() *PartitionNetworks {
+	if in == nil {
+		return nil
+	}
+	out := new(PartitionNetworks)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,18 @@
+package v1alpha2
+
+import (
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"k8s.io/apimachinery/pkg/conversion"
+)
+
+// Convert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec converts the deprecated network field of the internal version into networks
+func Convert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec(in *api.MetalProviderSpec, out *MetalProviderSpec, s conversion.Scope) error {
+	if err := autoConvert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec(in, out, s); err != nil {
+		return err
+	}
+	if in.Network != "" {
+		out.Networks = append([]Network{{ID: in.Network, Autoacquire: pointer.Pointer(true)}}, out.Networks...)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package v1alpha2
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestConvert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *api.MetalProviderSpec
+		want *MetalProviderSpec
+	}{
+		{
+			name: "network is converted into networks",
+			in: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Network:   "a-network",
+				Tags:      []string{"a=b"},
+			},
+			want: &MetalProviderSpec{
+				Partition: "a-partition",
+				Networks:  []Network{{ID: "a-network", Autoacquire: pointer.Pointer(true)}},
+				Tags:      []string{"a=b"},
+			},
+		},
+		{
+			name: "networks are kept",
+			in: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Networks:  []api.Network{{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}}},
+			},
+			want: &MetalProviderSpec{
+				Partition: "a-partition",
+				Networks:  []Network{{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			if err := api.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+
+			got := &MetalProviderSpec{}
+			if err := scheme.Convert(tt.in, got, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
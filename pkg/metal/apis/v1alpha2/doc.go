@@ -0,0 +1,7 @@
+// +k8s:deepcopy-gen=package
+// +k8s:conversion-gen=github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=machine.metal-stack.io
+
+// Package v1alpha2 is the current version of the provider spec api, it replaces the network field by networks
+package v1alpha2
@@ -0,0 +1,30 @@
+package v1alpha2
+
+import (
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// SchemeGroupVersion is the group version of this api version
+	SchemeGroupVersion = schema.GroupVersion{Group: api.GroupName, Version: "v1alpha2"}
+
+	// SchemeBuilder is used to add the types, conversions and defaults of this version to a scheme
+	SchemeBuilder      runtime.SchemeBuilder
+	localSchemeBuilder = &SchemeBuilder
+	// AddToScheme adds the types, conversions and defaults of this version to a scheme
+	AddToScheme = localSchemeBuilder.AddToScheme
+)
+
+func init() {
+	// the generated conversion functions register themselves in their init function
+	localSchemeBuilder.Register(addKnownTypes, addDefaultingFuncs)
+}
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&MetalProviderSpec{},
+	)
+	return nil
+}
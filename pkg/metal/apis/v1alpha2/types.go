@@ -0,0 +1,76 @@
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MetalProviderSpec is the spec of a metal-stack machine class.
+type MetalProviderSpec struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Partition  string      `json:"partition"` // required
+	Size       string      `json:"size"`      // required
+	Image      string      `json:"image"`     // required
+	Project    string      `json:"project"`   // required
+	Networks   []Network   `json:"networks"`  // required
+	Tags       []string    `json:"tags,omitempty"`
+	SSHKeys    []string    `json:"sshKeys,omitempty"`
+	DNSServers []DNSServer `json:"dnsServers,omitempty"`
+	NTPServers []NTPServer `json:"ntpServers,omitempty"`
+	// MachineIDs optionally pins the allocation to specific machines, they are tried in the given order.
+	// If empty, the metal-api picks any free machine of the given size in the partition.
+	MachineIDs []string `json:"machineIDs,omitempty"`
+	// FilesystemLayout is the filesystem layout the machine is installed with, if empty the metal-api picks the default layout.
+	FilesystemLayout string `json:"filesystemLayout,omitempty"`
+	// VerifyFilesystemLayout checks that the filesystem layout is compatible with the size and image before allocating a machine.
+	VerifyFilesystemLayout bool `json:"verifyFilesystemLayout,omitempty"`
+	// FallbackSizes are tried in the given order if there are no free machines of the size.
+	FallbackSizes []string `json:"fallbackSizes,omitempty"`
+	// FallbackPartitions are tried in the given order if there are no free machines of the size or any fallback size in the partition.
+	FallbackPartitions []string `json:"fallbackPartitions,omitempty"`
+	// FallbackNetworks are the networks the machine is attached to in the fallback partitions instead of the networks.
+	// They are required for every fallback partition, as the private network of a machine belongs to a single partition.
+	FallbackNetworks []PartitionNetworks `json:"fallbackNetworks,omitempty"`
+	// SizeReservationPolicy defines whether machines are allocated from the size reservations of the project.
+	// Required fails the allocation if the size reservation is exhausted, Preferred falls back to unreserved machines.
+	// If empty, size reservations are not checked.
+	SizeReservationPolicy SizeReservationPolicy `json:"sizeReservationPolicy,omitempty"`
+}
+
+// SizeReservationPolicy defines how size reservations of the project are used on allocation.
+type SizeReservationPolicy string
+
+const (
+	// SizeReservationPolicyRequired only allocates machines from the size reservations of the project
+	SizeReservationPolicyRequired SizeReservationPolicy = "Required"
+	// SizeReservationPolicyPreferred allocates unreserved machines if the size reservations of the project are exhausted
+	SizeReservationPolicyPreferred SizeReservationPolicy = "Preferred"
+)
+
+// Network is a network the machine is attached to on allocation.
+type Network struct {
+	ID string `json:"id"`
+	// Autoacquire acquires an ip address from this network automatically, defaults to true if no ips are given.
+	// If disabled, the ip addresses of this network have to be given explicitly.
+	Autoacquire *bool `json:"autoacquire,omitempty"`
+	// IPs are static ip addresses of this network which were acquired in the project before.
+	IPs []string `json:"ips,omitempty"`
+}
+
+// PartitionNetworks are the networks the machine is attached to on allocation in a partition.
+type PartitionNetworks struct {
+	Partition string    `json:"partition"`
+	Networks  []Network `json:"networks"`
+}
+
+// DNSServer is a dns server configured on the machine.
+type DNSServer struct {
+	IP string `json:"ip"`
+}
+
+// NTPServer is an ntp server configured on the machine.
+type NTPServer struct {
+	Address string `json:"address"`
+}
@@ -0,0 +1,222 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright (c) 2026 SAP SE or an SAP affiliate company. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by conversion-gen. DO NOT EDIT.
+
+package v1alpha2
+
+import (
+	unsafe "unsafe"
+
+	apis "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	conversion "k8s.io/apimachinery/pkg/conversion"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	localSchemeBuilder.Register(RegisterConversions)
+}
+
+// RegisterConversions adds conversion functions to the given scheme.
+// Public to allow building arbitrary schemes.
+func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*DNSServer)(nil), (*apis.DNSServer)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_DNSServer_To_apis_DNSServer(a.(*DNSServer), b.(*apis.DNSServer), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*apis.DNSServer)(nil), (*DNSServer)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apis_DNSServer_To_v1alpha2_DNSServer(a.(*apis.DNSServer), b.(*DNSServer), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*MetalProviderSpec)(nil), (*apis.MetalProviderSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_MetalProviderSpec_To_apis_MetalProviderSpec(a.(*MetalProviderSpec), b.(*apis.MetalProviderSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*NTPServer)(nil), (*apis.NTPServer)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_NTPServer_To_apis_NTPServer(a.(*NTPServer), b.(*apis.NTPServer), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*apis.NTPServer)(nil), (*NTPServer)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apis_NTPServer_To_v1alpha2_NTPServer(a.(*apis.NTPServer), b.(*NTPServer), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Network)(nil), (*apis.Network)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_Network_To_apis_Network(a.(*Network), b.(*apis.Network), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*apis.Network)(nil), (*Network)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apis_Network_To_v1alpha2_Network(a.(*apis.Network), b.(*Network), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*PartitionNetworks)(nil), (*apis.PartitionNetworks)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_PartitionNetworks_To_apis_PartitionNetworks(a.(*PartitionNetworks), b.(*apis.PartitionNetworks), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*apis.PartitionNetworks)(nil), (*PartitionNetworks)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apis_PartitionNetworks_To_v1alpha2_PartitionNetworks(a.(*apis.PartitionNetworks), b.(*PartitionNetworks), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*apis.MetalProviderSpec)(nil), (*MetalProviderSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec(a.(*apis.MetalProviderSpec), b.(*MetalProviderSpec), scope)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func autoConvert_v1alpha2_DNSServer_To_apis_DNSServer(in *DNSServer, out *apis.DNSServer, s conversion.Scope) error {
+	out.IP = in.IP
+	return nil
+}
+
+// Convert_v1alpha2_DNSServer_To_apis_DNSServer is an autogenerated conversion function.
+func Convert_v1alpha2_DNSServer_To_apis_DNSServer(in *DNSServer, out *apis.DNSServer, s conversion.Scope) error {
+	return autoConvert_v1alpha2_DNSServer_To_apis_DNSServer(in, out, s)
+}
+
+func autoConvert_apis_DNSServer_To_v1alpha2_DNSServer(in *apis.DNSServer, out *DNSServer, s conversion.Scope) error {
+	out.IP = in.IP
+	return nil
+}
+
+// Convert_apis_DNSServer_To_v1alpha2_DNSServer is an autogenerated conversion function.
+func Convert_apis_DNSServer_To_v1alpha2_DNSServer(in *apis.DNSServer, out *DNSServer, s conversion.Scope) error {
+	return autoConvert_apis_DNSServer_To_v1alpha2_DNSServer(in, out, s)
+}
+
+func autoConvert_v1alpha2_MetalProviderSpec_To_apis_MetalProviderSpec(in *MetalProviderSpec, out *apis.MetalProviderSpec, s conversion.Scope) error {
+	out.Partition = in.Partition
+	out.Size = in.Size
+	out.Image = in.Image
+	out.Project = in.Project
+	out.Networks = *(*[]apis.Network)(unsafe.Pointer(&in.Networks))
+	out.Tags = *(*[]string)(unsafe.Pointer(&in.Tags))
+	out.SSHKeys = *(*[]string)(unsafe.Pointer(&in.SSHKeys))
+	out.DNSServers = *(*[]apis.DNSServer)(unsafe.Pointer(&in.DNSServers))
+	out.NTPServers = *(*[]apis.NTPServer)(unsafe.Pointer(&in.NTPServers))
+	out.MachineIDs = *(*[]string)(unsafe.Pointer(&in.MachineIDs))
+	out.FilesystemLayout = in.FilesystemLayout
+	out.VerifyFilesystemLayout = in.VerifyFilesystemLayout
+	out.FallbackSizes = *(*[]string)(unsafe.Pointer(&in.FallbackSizes))
+	out.FallbackPartitions = *(*[]string)(unsafe.Pointer(&in.FallbackPartitions))
+	out.FallbackNetworks = *(*[]apis.PartitionNetworks)(unsafe.Pointer(&in.FallbackNetworks))
+	out.SizeReservationPolicy = apis.SizeReservationPolicy(in.SizeReservationPolicy)
+	return nil
+}
+
+// Convert_v1alpha2_MetalProviderSpec_To_apis_MetalProviderSpec is an autogenerated conversion function.
+func Convert_v1alpha2_MetalProviderSpec_To_apis_MetalProviderSpec(in *MetalProviderSpec, out *apis.MetalProviderSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha2_MetalProviderSpec_To_apis_MetalProviderSpec(in, out, s)
+}
+
+func autoConvert_apis_MetalProviderSpec_To_v1alpha2_MetalProviderSpec(in *apis.MetalProviderSpec, out *MetalProviderSpec, s conversion.Scope) error {
+	out.Partition = in.Partition
+	out.Size = in.Size
+	out.Image = in.Image
+	out.Project = in.Project
+	// WARNING: in.Network requires manual conversion: does not exist in peer-type
+	out.Networks = *(*[]Network)(unsafe.Pointer(&in.Networks))
+	out.Tags = *(*[]string)(unsafe.Pointer(&in.Tags))
+	out.SSHKeys = *(*[]string)(unsafe.Pointer(&in.SSHKeys))
+	out.DNSServers = *(*[]DNSServer)(unsafe.Pointer(&in.DNSServers))
+	out.NTPServers = *(*[]NTPServer)(unsafe.Pointer(&in.NTPServers))
+	out.MachineIDs = *(*[]string)(unsafe.Pointer(&in.MachineIDs))
+	out.FilesystemLayout = in.FilesystemLayout
+	out.VerifyFilesystemLayout = in.VerifyFilesystemLayout
+	out.FallbackSizes = *(*[]string)(unsafe.Pointer(&in.FallbackSizes))
+	out.FallbackPartitions = *(*[]string)(unsafe.Pointer(&in.FallbackPartitions))
+	out.FallbackNetworks = *(*[]PartitionNetworks)(unsafe.Pointer(&in.FallbackNetworks))
+	out.SizeReservationPolicy = SizeReservationPolicy(in.SizeReservationPolicy)
+	return nil
+}
+
+func autoConvert_v1alpha2_NTPServer_To_apis_NTPServer(in *NTPServer, out *apis.NTPServer, s conversion.Scope) error {
+	out.Address = in.Address
+	return nil
+}
+
+// Convert_v1alpha2_NTPServer_To_apis_NTPServer is an autogenerated conversion function.
+func Convert_v1alpha2_NTPServer_To_apis_NTPServer(in *NTPServer, out *apis.NTPServer, s conversion.Scope) error {
+	return autoConvert_v1alpha2_NTPServer_To_apis_NTPServer(in, out, s)
+}
+
+func autoConvert_apis_NTPServer_To_v1alpha2_NTPServer(in *apis.NTPServer, out *NTPServer, s conversion.Scope) error {
+	out.Address = in.Address
+	return nil
+}
+
+// Convert_apis_NTPServer_To_v1alpha2_NTPServer is an autogenerated conversion function.
+func Convert_apis_NTPServer_To_v1alpha2_NTPServer(in *apis.NTPServer, out *NTPServer, s conversion.Scope) error {
+	return autoConvert_apis_NTPServer_To_v1alpha2_NTPServer(in, out, s)
+}
+
+func autoConvert_v1alpha2_Network_To_apis_Network(in *Network, out *apis.Network, s conversion.Scope) error {
+	out.ID = in.ID
+	out.Autoacquire = (*bool)(unsafe.Pointer(in.Autoacquire))
+	out.IPs = *(*[]string)(unsafe.Pointer(&in.IPs))
+	return nil
+}
+
+// Convert_v1alpha2_Network_To_apis_Network is an autogenerated conversion function.
+func Convert_v1alpha2_Network_To_apis_Network(in *Network, out *apis.Network, s conversion.Scope) error {
+	return autoConvert_v1alpha2_Network_To_apis_Network(in, out, s)
+}
+
+func autoConvert_apis_Network_To_v1alpha2_Network(in *apis.Network, out *Network, s conversion.Scope) error {
+	out.ID = in.ID
+	out.Autoacquire = (*bool)(unsafe.Pointer(in.Autoacquire))
+	out.IPs = *(*[]string)(unsafe.Pointer(&in.IPs))
+	return nil
+}
+
+// Convert_apis_Network_To_v1alpha2_Network is an autogenerated conversion function.
+func Convert_apis_Network_To_v1alpha2_Network(in *apis.Network, out *Network, s conversion.Scope) error {
+	return autoConvert_apis_Network_To_v1alpha2_Network(in, out, s)
+}
+
+func autoConvert_v1alpha2_PartitionNetworks_To_apis_PartitionNetworks(in *PartitionNetworks, out *apis.PartitionNetworks, s conversion.Scope) error {
+	out.Partition = in.Partition
+	out.Networks = *(*[]apis.Network)(unsafe.Pointer(&in.Networks))
+	return nil
+}
+
+// Convert_v1alpha2_PartitionNetworks_To_apis_PartitionNetworks is an autogenerated conversion function.
+func Convert_v1alpha2_PartitionNetworks_To_apis_PartitionNetworks(in *PartitionNetworks, out *apis.PartitionNetworks, s conversion.Scope) error {
+	return autoConvert_v1alpha2_PartitionNetworks_To_apis_PartitionNetworks(in, out, s)
+}
+
+func autoConvert_apis_PartitionNetworks_To_v1alpha2_PartitionNetworks(in *apis.PartitionNetworks, out *PartitionNetworks, s conversion.Scope) error {
+	out.Partition = in.Partition
+	out.Networks = *(*[]Network)(unsafe.Pointer(&in.Networks))
+	return nil
+}
+
+// Convert_apis_PartitionNetworks_To_v1alpha2_PartitionNetworks is an autogenerated conversion function.
+func Convert_apis_PartitionNetworks_To_v1alpha2_PartitionNetworks(in *apis.PartitionNetworks, out *PartitionNetworks, s conversion.Scope) error {
+	return autoConvert_apis_PartitionNetworks_To_v1alpha2_PartitionNetworks(in, out, s)
+}
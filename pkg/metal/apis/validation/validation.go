@@ -3,43 +3,271 @@ package validation
 
 import (
 	"fmt"
+	"net/netip"
+	"slices"
 
+	"github.com/google/uuid"
 	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// maxDNSServers is the maximum amount of dns servers accepted by the metal-api
+	maxDNSServers = 3
+	// minNTPServers and maxNTPServers are the amount of ntp servers accepted by the metal-api
+	minNTPServers = 3
+	maxNTPServers = 5
 )
 
 // ValidateMetalProviderSpec validates provider spec and secret to check if all fields are present and valid
-func ValidateMetalProviderSpec(spec *api.MetalProviderSpec, secrets *corev1.Secret) []error {
-	var allErrs []error
+func ValidateMetalProviderSpec(spec *api.MetalProviderSpec, secret *corev1.Secret) field.ErrorList {
+	var (
+		allErrs  field.ErrorList
+		specPath = field.NewPath("providerSpec")
+	)
 
 	if spec.Image == "" {
-		allErrs = append(allErrs, fmt.Errorf("image is required field"))
-	}
-	if spec.Network == "" {
-		allErrs = append(allErrs, fmt.Errorf("network is required field"))
+		allErrs = append(allErrs, field.Required(specPath.Child("image"), "image is required"))
 	}
 	if spec.Partition == "" {
-		allErrs = append(allErrs, fmt.Errorf("partition is required field"))
+		allErrs = append(allErrs, field.Required(specPath.Child("partition"), "partition is required"))
 	}
 	if spec.Project == "" {
-		allErrs = append(allErrs, fmt.Errorf("project is required field"))
+		allErrs = append(allErrs, field.Required(specPath.Child("project"), "project is required"))
 	}
 	if spec.Size == "" {
-		allErrs = append(allErrs, fmt.Errorf("size is required field"))
+		allErrs = append(allErrs, field.Required(specPath.Child("size"), "size is required"))
+	}
+
+	if spec.VerifyFilesystemLayout && spec.FilesystemLayout == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("filesystemLayout"), "filesystemLayout is required if verifyFilesystemLayout is enabled"))
+	}
+
+	switch spec.SizeReservationPolicy {
+	case "", api.SizeReservationPolicyRequired, api.SizeReservationPolicyPreferred:
+	default:
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("sizeReservationPolicy"), spec.SizeReservationPolicy, []api.SizeReservationPolicy{api.SizeReservationPolicyRequired, api.SizeReservationPolicyPreferred}))
+	}
+
+	allErrs = append(allErrs, validateNetworks(spec, specPath)...)
+	allErrs = append(allErrs, validateMachineIDs(spec.MachineIDs, specPath.Child("machineIDs"))...)
+	allErrs = append(allErrs, validateFallbacks(spec.Size, spec.FallbackSizes, specPath.Child("fallbackSizes"))...)
+	allErrs = append(allErrs, validateFallbacks(spec.Partition, spec.FallbackPartitions, specPath.Child("fallbackPartitions"))...)
+	allErrs = append(allErrs, validateFallbackNetworks(spec, specPath)...)
+
+	if len(spec.MachineIDs) > 0 && (len(spec.FallbackSizes) > 0 || len(spec.FallbackPartitions) > 0) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("machineIDs"), "machineIDs can not be combined with fallback sizes or partitions"))
+	}
+	allErrs = append(allErrs, validateDNSServers(spec.DNSServers, specPath.Child("dnsServers"))...)
+	allErrs = append(allErrs, validateNTPServers(spec.NTPServers, specPath.Child("ntpServers"))...)
+	allErrs = append(allErrs, validateSecret(secret, field.NewPath("secret").Child("data"))...)
+
+	return allErrs
+}
+
+// ValidatePartitionServers validates the dns and ntp servers of a partition, which are used for provider specs without dns or ntp servers
+func ValidatePartitionServers(partitionID string, dnsServers []api.DNSServer, ntpServers []api.NTPServer) field.ErrorList {
+	var (
+		allErrs       field.ErrorList
+		partitionPath = field.NewPath("partition").Key(partitionID)
+	)
+
+	allErrs = append(allErrs, validateDNSServers(dnsServers, partitionPath.Child("dnsServers"))...)
+	allErrs = append(allErrs, validateNTPServers(ntpServers, partitionPath.Child("ntpServers"))...)
+
+	return allErrs
+}
+
+func validateNetworks(spec *api.MetalProviderSpec, fldPath *field.Path) field.ErrorList {
+	var (
+		allErrs      field.ErrorList
+		networksPath = fldPath.Child("networks")
+	)
+
+	switch {
+	case spec.Network == "" && len(spec.Networks) == 0:
+		allErrs = append(allErrs, field.Required(fldPath.Child("network"), "either network or networks is required"))
+	case spec.Network != "" && len(spec.Networks) > 0:
+		allErrs = append(allErrs, field.Forbidden(networksPath, "network and networks are mutually exclusive"))
+	}
+
+	allErrs = append(allErrs, validateNetworkList(spec.Networks, networksPath)...)
+
+	return allErrs
+}
+
+func validateNetworkList(networks []api.Network, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, n := range networks {
+		idxPath := fldPath.Index(i)
+
+		if n.ID == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("id"), "network id is required"))
+		} else if seen[n.ID] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("id"), n.ID))
+		}
+		seen[n.ID] = true
+
+		autoacquire := n.AutoacquireEnabled()
+		if autoacquire && len(n.IPs) > 0 {
+			allErrs = append(allErrs, field.Forbidden(idxPath.Child("ips"), "ips can only be given if autoacquire is disabled"))
+		}
+		if !autoacquire && len(n.IPs) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("ips"), "ips are required if autoacquire is disabled"))
+		}
+
+		for j, ip := range n.IPs {
+			if _, err := netip.ParseAddr(ip); err != nil {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("ips").Index(j), ip, "must be a valid ip address"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateDNSServers(servers []api.DNSServer, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(servers) > maxDNSServers {
+		allErrs = append(allErrs, field.TooMany(fldPath, len(servers), maxDNSServers))
+	}
+
+	seen := map[string]bool{}
+	for i, s := range servers {
+		idxPath := fldPath.Index(i).Child("ip")
+
+		if s.IP == "" {
+			allErrs = append(allErrs, field.Required(idxPath, "dns server ip must not be empty"))
+			continue
+		}
+		if _, err := netip.ParseAddr(s.IP); err != nil {
+			allErrs = append(allErrs, field.Invalid(idxPath, s.IP, "must be a valid ip address"))
+			continue
+		}
+		if seen[s.IP] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, s.IP))
+		}
+		seen[s.IP] = true
+	}
+
+	return allErrs
+}
+
+func validateNTPServers(servers []api.NTPServer, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(servers) > 0 && (len(servers) < minNTPServers || len(servers) > maxNTPServers) {
+		allErrs = append(allErrs, field.Invalid(fldPath, len(servers), fmt.Sprintf("must contain between %d and %d ntp servers", minNTPServers, maxNTPServers)))
+	}
+
+	seen := map[string]bool{}
+	for i, s := range servers {
+		idxPath := fldPath.Index(i).Child("address")
+
+		if s.Address == "" {
+			allErrs = append(allErrs, field.Required(idxPath, "ntp server address must not be empty"))
+			continue
+		}
+		if _, err := netip.ParseAddr(s.Address); err != nil {
+			if msgs := validation.IsDNS1123Subdomain(s.Address); len(msgs) > 0 {
+				allErrs = append(allErrs, field.Invalid(idxPath, s.Address, "must be a valid ip address or hostname"))
+				continue
+			}
+		}
+		if seen[s.Address] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, s.Address))
+		}
+		seen[s.Address] = true
+	}
+
+	return allErrs
+}
+
+func validateMachineIDs(ids []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), id, "must be a valid uuid"))
+			continue
+		}
+		if seen[id] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), id))
+		}
+		seen[id] = true
+	}
+
+	return allErrs
+}
+
+func validateFallbacks(primary string, fallbacks []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{primary: true}
+	for i, f := range fallbacks {
+		if f == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i), "fallback must not be empty"))
+			continue
+		}
+		if seen[f] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), f))
+		}
+		seen[f] = true
+	}
+
+	return allErrs
+}
+
+// validateFallbackNetworks requires own networks for every fallback partition, as the networks of the
+// partition can not be used in other partitions if they contain a private network
+func validateFallbackNetworks(spec *api.MetalProviderSpec, fldPath *field.Path) field.ErrorList {
+	var (
+		allErrs      field.ErrorList
+		networksPath = fldPath.Child("fallbackNetworks")
+	)
+
+	seen := map[string]bool{}
+	for i, pn := range spec.FallbackNetworks {
+		idxPath := networksPath.Index(i)
+
+		switch {
+		case !slices.Contains(spec.FallbackPartitions, pn.Partition):
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("partition"), pn.Partition, "must be a fallback partition"))
+		case seen[pn.Partition]:
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("partition"), pn.Partition))
+		}
+		seen[pn.Partition] = true
+
+		if len(pn.Networks) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("networks"), "networks are required"))
+		}
+		allErrs = append(allErrs, validateNetworkList(pn.Networks, idxPath.Child("networks"))...)
 	}
 
-	allErrs = append(allErrs, validateSecrets(secrets)...)
+	for i, partition := range spec.FallbackPartitions {
+		if partition != "" && !seen[partition] {
+			allErrs = append(allErrs, field.Required(fldPath.Child("fallbackPartitions").Index(i), fmt.Sprintf("networks of fallback partition %q are required in fallbackNetworks, as private networks belong to a single partition", partition)))
+		}
+	}
 
 	return allErrs
 }
 
-func validateSecrets(secret *corev1.Secret) []error {
-	var allErrs []error
+func validateSecret(secret *corev1.Secret, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
 	if (string(secret.Data["metalAPIHMac"]) == "") == (string(secret.Data["metalAPIKey"]) == "") {
-		allErrs = append(allErrs, fmt.Errorf("either metalAPIHMac or metalAPIKey is required field"))
+		allErrs = append(allErrs, field.Required(fldPath.Child("metalAPIKey"), "either metalAPIHMac or metalAPIKey is required"))
 	}
 	if string(secret.Data["metalAPIURL"]) == "" {
-		allErrs = append(allErrs, fmt.Errorf("secret metalAPIURL is required field"))
+		allErrs = append(allErrs, field.Required(fldPath.Child("metalAPIURL"), "metalAPIURL is required"))
 	}
+
 	return allErrs
 }
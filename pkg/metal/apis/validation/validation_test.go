@@ -0,0 +1,209 @@
+package validation
+
+import (
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("Validation", func() {
+	var (
+		spec   *api.MetalProviderSpec
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		spec = &api.MetalProviderSpec{
+			Partition: "a-partition",
+			Size:      "c1-xlarge-x86",
+			Image:     "ubuntu-24.4",
+			Project:   "a-project",
+			Network:   "a-network",
+		}
+		secret = &corev1.Secret{
+			Data: map[string][]byte{
+				"metalAPIURL": []byte("http://metal-api"),
+				"metalAPIKey": []byte("a-token"),
+			},
+		}
+	})
+
+	Describe("#ValidateMetalProviderSpec", func() {
+		It("should accept a valid provider spec", func() {
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(BeEmpty())
+		})
+
+		It("should accept a provider spec with multiple networks", func() {
+			spec.Network = ""
+			spec.Networks = []api.Network{
+				{ID: "a-network"},
+				{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}},
+			}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(BeEmpty())
+		})
+
+		It("should accept networks with ips but without autoacquire", func() {
+			spec.Network = ""
+			spec.Networks = []api.Network{
+				{ID: "a-network"},
+				{ID: "internet", IPs: []string{"212.34.83.10"}},
+			}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(BeEmpty())
+		})
+
+		It("should report all missing fields at once", func() {
+			spec = &api.MetalProviderSpec{}
+			secret = &corev1.Secret{}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Required(field.NewPath("providerSpec", "image"), "image is required"),
+				field.Required(field.NewPath("providerSpec", "partition"), "partition is required"),
+				field.Required(field.NewPath("providerSpec", "project"), "project is required"),
+				field.Required(field.NewPath("providerSpec", "size"), "size is required"),
+				field.Required(field.NewPath("providerSpec", "network"), "either network or networks is required"),
+				field.Required(field.NewPath("secret", "data", "metalAPIKey"), "either metalAPIHMac or metalAPIKey is required"),
+				field.Required(field.NewPath("secret", "data", "metalAPIURL"), "metalAPIURL is required"),
+			}))
+		})
+
+		It("should reject both hmac and api key", func() {
+			secret.Data["metalAPIHMac"] = []byte("a-hmac")
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Required(field.NewPath("secret", "data", "metalAPIKey"), "either metalAPIHMac or metalAPIKey is required"),
+			}))
+		})
+
+		It("should require a filesystem layout if it should be verified", func() {
+			spec.VerifyFilesystemLayout = true
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Required(field.NewPath("providerSpec", "filesystemLayout"), "filesystemLayout is required if verifyFilesystemLayout is enabled"),
+			}))
+		})
+
+		It("should reject an unknown size reservation policy", func() {
+			spec.SizeReservationPolicy = "Always"
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.NotSupported(field.NewPath("providerSpec", "sizeReservationPolicy"), api.SizeReservationPolicy("Always"), []api.SizeReservationPolicy{api.SizeReservationPolicyRequired, api.SizeReservationPolicyPreferred}),
+			}))
+		})
+
+		It("should report invalid networks with their path", func() {
+			spec.Networks = []api.Network{
+				{ID: "a-network"},
+				{ID: ""},
+				{ID: "a-network", Autoacquire: pointer.Pointer(true), IPs: []string{"10.0.0.1"}},
+				{ID: "internet", Autoacquire: pointer.Pointer(false)},
+				{ID: "storage", Autoacquire: pointer.Pointer(false), IPs: []string{"10.0.0.300"}},
+			}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Forbidden(field.NewPath("providerSpec", "networks"), "network and networks are mutually exclusive"),
+				field.Required(field.NewPath("providerSpec", "networks").Index(1).Child("id"), "network id is required"),
+				field.Duplicate(field.NewPath("providerSpec", "networks").Index(2).Child("id"), "a-network"),
+				field.Forbidden(field.NewPath("providerSpec", "networks").Index(2).Child("ips"), "ips can only be given if autoacquire is disabled"),
+				field.Required(field.NewPath("providerSpec", "networks").Index(3).Child("ips"), "ips are required if autoacquire is disabled"),
+				field.Invalid(field.NewPath("providerSpec", "networks").Index(4).Child("ips").Index(0), "10.0.0.300", "must be a valid ip address"),
+			}))
+		})
+
+		It("should report invalid machine ids with their path", func() {
+			spec.MachineIDs = []string{"00000000-0000-0000-0000-000000000001", "not-a-uuid", "00000000-0000-0000-0000-000000000001"}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Invalid(field.NewPath("providerSpec", "machineIDs").Index(1), "not-a-uuid", "must be a valid uuid"),
+				field.Duplicate(field.NewPath("providerSpec", "machineIDs").Index(2), "00000000-0000-0000-0000-000000000001"),
+			}))
+		})
+
+		It("should report invalid fallbacks with their path", func() {
+			spec.MachineIDs = []string{"00000000-0000-0000-0000-000000000001"}
+			spec.FallbackSizes = []string{"c1-large-x86", "c1-xlarge-x86", ""}
+			spec.FallbackPartitions = []string{"b-partition", "b-partition"}
+			spec.FallbackNetworks = []api.PartitionNetworks{{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}}}}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Duplicate(field.NewPath("providerSpec", "fallbackSizes").Index(1), "c1-xlarge-x86"),
+				field.Required(field.NewPath("providerSpec", "fallbackSizes").Index(2), "fallback must not be empty"),
+				field.Duplicate(field.NewPath("providerSpec", "fallbackPartitions").Index(1), "b-partition"),
+				field.Forbidden(field.NewPath("providerSpec", "machineIDs"), "machineIDs can not be combined with fallback sizes or partitions"),
+			}))
+		})
+
+		It("should report missing and invalid fallback networks with their path", func() {
+			spec.FallbackPartitions = []string{"b-partition", "c-partition", "d-partition"}
+			spec.FallbackNetworks = []api.PartitionNetworks{
+				{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}}},
+				{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}}},
+				{Partition: "c-partition"},
+				{Partition: "a-partition", Networks: []api.Network{{ID: "a-network"}, {ID: "a-network"}}},
+			}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Duplicate(field.NewPath("providerSpec", "fallbackNetworks").Index(1).Child("partition"), "b-partition"),
+				field.Required(field.NewPath("providerSpec", "fallbackNetworks").Index(2).Child("networks"), "networks are required"),
+				field.Invalid(field.NewPath("providerSpec", "fallbackNetworks").Index(3).Child("partition"), "a-partition", "must be a fallback partition"),
+				field.Duplicate(field.NewPath("providerSpec", "fallbackNetworks").Index(3).Child("networks").Index(1).Child("id"), "a-network"),
+				field.Required(field.NewPath("providerSpec", "fallbackPartitions").Index(2), `networks of fallback partition "d-partition" are required in fallbackNetworks, as private networks belong to a single partition`),
+			}))
+		})
+
+		It("should report invalid dns servers with their path", func() {
+			spec.DNSServers = []api.DNSServer{{IP: "dns.google"}}
+
+			Expect(ValidateMetalProviderSpec(spec, secret)).To(Equal(field.ErrorList{
+				field.Invalid(field.NewPath("providerSpec", "dnsServers").Index(0).Child("ip"), "dns.google", "must be a valid ip address"),
+			}))
+		})
+	})
+
+	Describe("#validateDNSServers", func() {
+		DescribeTable("should validate dns servers",
+			func(servers []api.DNSServer, want field.ErrorList) {
+				Expect(validateDNSServers(servers, field.NewPath("dnsServers"))).To(Equal(want))
+			},
+			Entry("no dns servers", nil, nil),
+			Entry("valid dns servers", []api.DNSServer{{IP: "1.1.1.1"}, {IP: "2001:4860:4860::8888"}}, nil),
+			Entry("invalid ip", []api.DNSServer{{IP: "1.1.1.1"}, {IP: "dns.google"}}, field.ErrorList{
+				field.Invalid(field.NewPath("dnsServers").Index(1).Child("ip"), "dns.google", "must be a valid ip address"),
+			}),
+			Entry("empty ip", []api.DNSServer{{IP: ""}}, field.ErrorList{
+				field.Required(field.NewPath("dnsServers").Index(0).Child("ip"), "dns server ip must not be empty"),
+			}),
+			Entry("duplicate ip", []api.DNSServer{{IP: "1.1.1.1"}, {IP: "1.1.1.1"}}, field.ErrorList{
+				field.Duplicate(field.NewPath("dnsServers").Index(1).Child("ip"), "1.1.1.1"),
+			}),
+			Entry("too many dns servers", []api.DNSServer{{IP: "1.1.1.1"}, {IP: "1.0.0.1"}, {IP: "8.8.8.8"}, {IP: "8.8.4.4"}}, field.ErrorList{
+				field.TooMany(field.NewPath("dnsServers"), 4, 3),
+			}),
+		)
+	})
+
+	Describe("#validateNTPServers", func() {
+		DescribeTable("should validate ntp servers",
+			func(servers []api.NTPServer, want field.ErrorList) {
+				Expect(validateNTPServers(servers, field.NewPath("ntpServers"))).To(Equal(want))
+			},
+			Entry("no ntp servers", nil, nil),
+			Entry("valid ntp servers", []api.NTPServer{{Address: "0.de.pool.ntp.org"}, {Address: "1.de.pool.ntp.org"}, {Address: "10.0.0.1"}}, nil),
+			Entry("invalid address", []api.NTPServer{{Address: "0.de.pool.ntp.org"}, {Address: "1.de.pool.ntp.org"}, {Address: "not_a_host"}}, field.ErrorList{
+				field.Invalid(field.NewPath("ntpServers").Index(2).Child("address"), "not_a_host", "must be a valid ip address or hostname"),
+			}),
+			Entry("empty and duplicate address", []api.NTPServer{{Address: "0.de.pool.ntp.org"}, {Address: ""}, {Address: "0.de.pool.ntp.org"}}, field.ErrorList{
+				field.Required(field.NewPath("ntpServers").Index(1).Child("address"), "ntp server address must not be empty"),
+				field.Duplicate(field.NewPath("ntpServers").Index(2).Child("address"), "0.de.pool.ntp.org"),
+			}),
+			Entry("too few ntp servers", []api.NTPServer{{Address: "0.de.pool.ntp.org"}}, field.ErrorList{
+				field.Invalid(field.NewPath("ntpServers"), 1, "must contain between 3 and 5 ntp servers"),
+			}),
+		)
+	})
+})
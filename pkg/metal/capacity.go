@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/partition"
+	"github.com/metal-stack/metal-go/api/client/size"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+)
+
+// checkCapacity returns a ResourceExhausted error if there are no free machines of the size in the partition,
+// machines reserved for the project are counted as free
+func checkCapacity(ctx context.Context, m metalgo.Client, project, partitionID, size string) error {
+	resp, err := m.Partition().PartitionCapacity(partition.NewPartitionCapacityParamsWithContext(ctx).WithBody(&models.V1PartitionCapacityRequest{
+		ID:        partitionID,
+		Sizeid:    size,
+		Projectid: pointer.Pointer(project),
+	}), nil)
+	if err != nil {
+		return metalErrorToStatus(err)
+	}
+
+	free := freeMachines(resp.Payload, partitionID, size)
+	if free <= 0 {
+		return status.Error(codes.ResourceExhausted, fmt.Sprintf("%d free %s machines in partition %s", free, size, partitionID))
+	}
+
+	return nil
+}
+
+func freeMachines(capacities []*models.V1PartitionCapacity, partition, size string) int32 {
+	var free int32
+	for _, pc := range capacities {
+		if pointer.SafeDeref(pc.ID) != partition {
+			continue
+		}
+		for _, sc := range pc.Servers {
+			if pointer.SafeDeref(sc.Size) == size {
+				free += sc.Free
+			}
+		}
+	}
+	return free
+}
+
+// checkSizeReservation returns a FailedPrecondition error if the project has no size reservation for the size in the partition
+// or if all reserved machines are already allocated
+func checkSizeReservation(ctx context.Context, m metalgo.Client, project, partitionID, sizeID string) error {
+	resp, err := m.Size().SizeReservationsUsage(size.NewSizeReservationsUsageParamsWithContext(ctx).WithBody(&models.V1SizeReservationListRequest{
+		Partitionid: partitionID,
+		Projectid:   project,
+		Sizeid:      sizeID,
+	}), nil)
+	if err != nil {
+		return metalErrorToStatus(err)
+	}
+
+	if len(resp.Payload) == 0 {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("project %s has no size reservation for %s machines in partition %s", project, sizeID, partitionID))
+	}
+
+	var amount, used int32
+	for _, r := range resp.Payload {
+		amount += pointer.SafeDeref(r.Amount)
+		used += pointer.SafeDeref(r.Usedamount)
+	}
+
+	if used >= amount {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("size reservation of project %s for %s machines in partition %s is exhausted, %d of %d reserved machines are allocated", project, sizeID, partitionID, used, amount))
+	}
+
+	return nil
+}
@@ -19,13 +19,18 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/filesystemlayout"
 	"github.com/metal-stack/metal-go/api/client/machine"
 	"github.com/metal-stack/metal-go/api/models"
 	"github.com/metal-stack/metal-lib/pkg/pointer"
@@ -33,14 +38,6 @@ import (
 	"k8s.io/klog/v2"
 )
 
-const (
-	machineCreateBackoff = 5 * time.Second
-)
-
-var (
-	machineCreateHistory = map[string]time.Time{}
-)
-
 // NOTE
 //
 // The basic working of the controller will work with just implementing the CreateMachine() & DeleteMachine() methods.
@@ -76,86 +73,272 @@ var (
 // It is optionally expected by the safety controller to use an identification mechanisms to map the VM Created by a providerSpec.
 // These could be done using tag(s)/resource-groups etc.
 // This logic is used by safety controller to delete orphan VMs which are not backed by any machine CRD
-func (p *Provider) CreateMachine(ctx context.Context, req *driver.CreateMachineRequest) (*driver.CreateMachineResponse, error) {
-	klog.V(2).Infof("machine creation request has been received for %q", req.Machine.Name)
-	providerSpec, err := decodeProviderSpecAndSecret(req.MachineClass, req.Secret)
+func (p *Provider) CreateMachine(ctx context.Context, req *driver.CreateMachineRequest) (res *driver.CreateMachineResponse, err error) {
+	ctx, logger := withLogValues(ctx, machineLogValues(operationCreate, req.Machine)...)
+	logger.V(2).Info("machine creation request has been received")
+	ctx, span := startSpan(ctx, "CreateMachine", machineAttributes(req.Machine)...)
+	defer func() {
+		if res != nil {
+			span.SetAttributes(providerIDAttributeKey.String(res.ProviderID))
+		}
+		endSpan(span, err)
+	}()
+	ctx, cancel := withTimeout(ctx, p.Options.Timeouts.Create)
+	defer cancel()
+
+	metrics := newOperationMetrics(operationCreate)
+	defer func() { metrics.observe(err) }()
+
+	providerSpec, err := decodeProviderSpecAndSecret(ctx, req.MachineClass, req.Secret, p.Options, !p.Options.WarnUnknownFields)
 	if err != nil {
-		klog.Error(err.Error())
+		logger.Error(err, "invalid provider spec")
 		return nil, err
 	}
+	metrics.withSpec(providerSpec)
+	span.SetAttributes(specAttributes(providerSpec)...)
 
 	clusterIDTag, ok := tag.NewTagMap(providerSpec.Tags).Value(tag.ClusterID)
 	if !ok {
-		klog.V(2).Infof("machine create request for machine %q failed because provider spec did not contain metal-stack cluster tag", req.Machine.Name)
-		return nil, status.Error(codes.Internal, "machine create request failed because provider spec did not contain metal-stack cluster tag")
+		logger.V(2).Info("machine creation request failed because provider spec did not contain metal-stack cluster tag")
+		return nil, status.Error(codes.InvalidArgument, "machine create request failed because provider spec did not contain metal-stack cluster tag")
 	}
 
-	if timestamp := machineCreateHistory[req.Machine.Name]; time.Since(timestamp) < machineCreateBackoff {
-		return nil, status.Error(codes.Internal, "backing off from machine creation because machine with this name was only created seconds ago...")
-	}
+	ctx, logger = withLogValues(ctx, specLogValues(providerSpec, clusterIDTag)...)
 
 	m, err := p.initClient(req.Secret)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to create metal-api client")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	networks := []*models.V1MachineAllocationNetwork{
-		{
-			Autoacquire: pointer.Pointer(true),
-			Networkid:   &providerSpec.Network,
-		},
+	// a previous creation request for this machine may have allocated a machine without the
+	// provider id reaching the machine object (e.g. on controller restarts), so this machine is returned
+	// instead of allocating another one
+	machineTag := machineIdentityTag(req.Machine)
+
+	existing, err := findAllocatedMachine(ctx, m, providerSpec.Project, clusterIDTag, machineTag)
+	if err != nil {
+		logger.Error(err, "unable to find an already allocated machine")
+		return nil, err
+	}
+	if existing != nil {
+		logger.V(2).Info("machine was already allocated, skipping allocation", "id", *existing.ID)
+		return &driver.CreateMachineResponse{
+			ProviderID:     encodeMachineID(*existing.Partition.ID, *existing.ID),
+			NodeName:       *existing.Allocation.Name,
+			LastKnownState: encodeMachineState(machineStateAllocated, existing),
+		}, nil
 	}
 
-	var dnsServers []*models.V1DNSServer
-	for _, s := range providerSpec.DNSServers {
-		dnsServers = append(dnsServers, &models.V1DNSServer{
-			IP: &s.IP,
-		})
+	image, err := resolveImage(ctx, m, providerSpec.Image)
+	if err != nil {
+		logger.Error(err, "unable to resolve image", "image", providerSpec.Image)
+		return nil, err
+	}
+	if image != providerSpec.Image {
+		logger.V(2).Info("image was resolved", "image", providerSpec.Image, "resolvedImage", image)
 	}
 
-	var ntpServers []*models.V1NTPServer
-	for _, s := range providerSpec.NTPServers {
-		ntpServers = append(ntpServers, &models.V1NTPServer{
-			Address: &s.Address,
-		})
+	var fsl *models.V1FilesystemLayoutResponse
+	if providerSpec.VerifyFilesystemLayout {
+		resp, err := m.Filesystemlayout().GetFilesystemLayout(filesystemlayout.NewGetFilesystemLayoutParamsWithContext(ctx).WithID(providerSpec.FilesystemLayout), nil)
+		if err != nil {
+			logger.Error(err, "unable to get filesystem layout", "filesystemLayout", providerSpec.FilesystemLayout)
+			return nil, metalErrorToStatus(err)
+		}
+		fsl = resp.Payload
 	}
 
+	// the dns and ntp servers missing in the provider spec are taken from the partition the machine is allocated in
+	partitionDefaults := p.Options.PartitionDefaults && (len(providerSpec.DNSServers) == 0 || len(providerSpec.NTPServers) == 0)
+	dnsServers, ntpServers := providerSpec.DNSServers, providerSpec.NTPServers
+
 	userData := strings.TrimSpace(string(req.Secret.Data["userData"]))
 
 	createRequest := &models.V1MachineAllocateRequest{
-		Description:   req.Machine.Name + " created by Gardener.",
-		Name:          req.Machine.Name,
-		Hostname:      req.Machine.Name,
-		UserData:      userData,
-		Sizeid:        &providerSpec.Size,
-		Projectid:     &providerSpec.Project,
-		Networks:      networks,
-		Partitionid:   &providerSpec.Partition,
-		Imageid:       &providerSpec.Image,
-		Tags:          providerSpec.Tags,
-		SSHPubKeys:    providerSpec.SSHKeys,
-		DNSServers:    dnsServers,
-		NtpServers:    ntpServers,
-		PlacementTags: []string{fmt.Sprintf("%s=%s", tag.ClusterID, clusterIDTag)},
-	}
-
-	mcr, err := m.Machine().AllocateMachine(machine.NewAllocateMachineParams().WithBody(createRequest), nil)
-	if err != nil {
-		klog.Errorf("could not create machine: %v", err)
-		return nil, status.Error(codes.Internal, err.Error())
+		Description:        req.Machine.Name + " created by Gardener.",
+		Name:               req.Machine.Name,
+		Hostname:           req.Machine.Name,
+		UserData:           userData,
+		Projectid:          &providerSpec.Project,
+		Imageid:            &image,
+		Filesystemlayoutid: providerSpec.FilesystemLayout,
+		SSHPubKeys:         providerSpec.SSHKeys,
+		PlacementTags:      []string{fmt.Sprintf("%s=%s", tag.ClusterID, clusterIDTag)},
 	}
 
-	klog.V(2).Infof("machine creation request has been processed for %q", req.Machine.Name)
+	// the fallback sizes and partitions are only tried if there is no capacity for the preceding ones
+	placements := allocationPlacements(providerSpec)
+
+	// the machine class tag identifies the worker pool of a machine, such that a machine released for recovery
+	// is only adopted by a machine object of the same worker pool
+	classTag := machineClassTag(req.MachineClass)
+
+	// a machine that was released for recovery by the deletion of an unhealthy machine object of the same worker pool
+	// is recovered and taken over instead of allocating another one
+	if p.Options.RecoveryAction != "" {
+		recoverable, err := findRecoverableMachine(ctx, m, providerSpec.Project, clusterIDTag, classTag, p.Options.RecoveryAction, p.Options.RecoveryTimeout, placements, time.Now())
+		if err != nil {
+			logger.Error(err, "unable to find a machine released for recovery")
+			return nil, err
+		}
+		if recoverable != nil {
+			recovered, err := recoverMachine(ctx, m, recoverable, p.Options.RecoveryAction, machineTag, req.Machine.Name)
+			if err != nil {
+				logger.Error(err, "unable to recover machine", "id", *recoverable.ID)
+				return nil, err
+			}
+			logger.V(2).Info("took over machine released for recovery", "id", *recovered.ID, "recoveryAction", p.Options.RecoveryAction)
+			// the node of the recovered machine keeps the hostname of the unhealthy machine object
+			return &driver.CreateMachineResponse{
+				ProviderID:     encodeMachineID(*recovered.Partition.ID, *recovered.ID),
+				NodeName:       *recovered.Allocation.Name,
+				LastKnownState: encodeMachineState(machineStateRecovering, recovered),
+			}, nil
+		}
+	}
 
-	machineCreateHistory[req.Machine.Name] = time.Now()
+	var (
+		allocated *models.V1MachineResponse
+		code      codes.Code
+		msgs      []string
+	)
+	for i, pl := range placements {
+		createRequest.Partitionid = pointer.Pointer(pl.partition)
+		createRequest.Sizeid = pointer.Pointer(pl.size)
+		createRequest.Tags = append(slices.Clone(providerSpec.Tags), machineTag, classTag)
+		if i > 0 {
+			createRequest.Tags = append(createRequest.Tags, tag.New(machineFallbackTagKey, pl.String()))
+		}
+
+		if partitionDefaults && (i == 0 || pl.partition != placements[i-1].partition) {
+			dnsServers, ntpServers, err = partitionServers(ctx, m, providerSpec, pl.partition)
+			if err != nil {
+				logger.Error(err, "unable to get the defaults of the partition", "placement", pl.String())
+				return nil, err
+			}
+		}
+		createRequest.DNSServers, createRequest.NtpServers = allocationServers(dnsServers, ntpServers)
+		// private networks belong to a single partition, so the fallback partitions have their own networks
+		createRequest.Networks, createRequest.Ips = allocationNetworks(providerSpec, pl.partition)
+		logEffectiveSpec(logger, providerSpec, pl, dnsServers, ntpServers)
+
+		allocated, err = p.allocateMachine(ctx, m, providerSpec, pl, fsl, createRequest)
+		if err == nil {
+			if i > 0 {
+				logger.V(2).Info("machine was allocated with fallback", "fallback", pl.String())
+			}
+			break
+		}
+
+		observeAllocationFailure(pl, providerSpec.Project, err)
+
+		s, _ := status.FromError(err)
+		code = s.Code()
+		msg := s.Message()
+		if len(placements) > 1 {
+			msg = fmt.Sprintf("%s: %s", pl, msg)
+		}
+		msgs = append(msgs, msg)
+
+		if code != codes.ResourceExhausted && code != codes.FailedPrecondition {
+			break
+		}
+	}
+	if allocated == nil {
+		return nil, status.Error(code, strings.Join(msgs, ", "))
+	}
+
+	logger.V(2).Info("machine creation request has been processed", "id", *allocated.ID)
 
 	return &driver.CreateMachineResponse{
-		ProviderID: encodeMachineID(providerSpec.Partition, *mcr.Payload.ID),
-		NodeName:   *mcr.Payload.Allocation.Name,
+		ProviderID:     encodeMachineID(*allocated.Partition.ID, *allocated.ID),
+		NodeName:       *allocated.Allocation.Name,
+		LastKnownState: encodeMachineState(machineStateAllocated, allocated),
 	}, nil
 }
 
+// logEffectiveSpec logs the provider spec with the placement, networks and dns and ntp servers a machine is allocated with,
+// which include the defaults of the partition the machine is allocated in
+func logEffectiveSpec(logger klog.Logger, spec *api.MetalProviderSpec, pl placement, dnsServers []api.DNSServer, ntpServers []api.NTPServer) {
+	if !logger.V(4).Enabled() {
+		return
+	}
+	effective := spec.DeepCopy()
+	effective.Partition, effective.Size = pl.partition, pl.size
+	if pl.partition != spec.Partition {
+		effective.Network = ""
+	}
+	effective.Networks = partitionNetworks(spec, pl.partition)
+	effective.DNSServers, effective.NTPServers = dnsServers, ntpServers
+	raw, _ := json.Marshal(effective)
+	logger.V(4).Info("effective provider spec", "placement", pl.String(), "spec", string(raw))
+}
+
+// allocateMachine allocates a machine of the size in the partition of the given placement
+func (p *Provider) allocateMachine(ctx context.Context, m metalgo.Client, spec *api.MetalProviderSpec, pl placement, fsl *models.V1FilesystemLayoutResponse, createRequest *models.V1MachineAllocateRequest) (*models.V1MachineResponse, error) {
+	logger := klog.FromContext(ctx)
+
+	if spec.SizeReservationPolicy != "" {
+		err := checkSizeReservation(ctx, m, spec.Project, pl.partition, pl.size)
+		if err != nil {
+			s, _ := status.FromError(err)
+			if spec.SizeReservationPolicy != api.SizeReservationPolicyPreferred || s.Code() != codes.FailedPrecondition {
+				logger.Error(err, "size reservation check failed", "placement", pl.String())
+				return nil, err
+			}
+			logger.V(2).Info("allocating an unreserved machine", "placement", pl.String(), "reason", s.Message())
+		}
+	}
+
+	if p.Options.CapacityCheck {
+		err := checkCapacity(ctx, m, spec.Project, pl.partition, pl.size)
+		if err != nil {
+			logger.Error(err, "capacity check failed", "placement", pl.String())
+			return nil, err
+		}
+	}
+
+	if fsl != nil && !filesystemLayoutMatches(fsl, pl.size, *createRequest.Imageid) {
+		logger.V(2).Info("machine creation failed because filesystem layout is not compatible with size and image", "filesystemLayout", spec.FilesystemLayout, "size", pl.size, "image", *createRequest.Imageid)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("filesystem layout %q is not compatible with size %q and image %q", spec.FilesystemLayout, pl.size, *createRequest.Imageid))
+	}
+
+	candidates := spec.MachineIDs
+	if len(candidates) == 0 {
+		// an empty uuid lets the metal-api pick any free machine
+		candidates = []string{""}
+	}
+
+	var (
+		code codes.Code
+		msgs []string
+	)
+	for _, uuid := range candidates {
+		createRequest.UUID = uuid
+
+		mcr, err := m.Machine().AllocateMachine(machine.NewAllocateMachineParamsWithContext(ctx).WithBody(createRequest), nil)
+		if err == nil {
+			return mcr.Payload, nil
+		}
+
+		logger.Error(err, "could not allocate machine", "placement", pl.String(), "uuid", uuid)
+		s, _ := status.FromError(metalErrorToStatus(err))
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.NotFound, codes.AlreadyExists:
+			// this candidate can not be allocated, so the next one is tried
+		default:
+			// allocations are not idempotent, a request that failed with a timeout or server error may have allocated
+			// the candidate anyway, so allocating the next candidate could allocate a second machine for this machine object
+			return nil, status.Error(s.Code(), s.Message())
+		}
+		code = s.Code()
+		msgs = append(msgs, s.Message())
+	}
+
+	return nil, status.Error(code, strings.Join(msgs, ", "))
+}
+
 // DeleteMachine handles a machine deletion request
 //
 // REQUEST PARAMETERS (driver.DeleteMachineRequest)
@@ -167,28 +350,42 @@ func (p *Provider) CreateMachine(ctx context.Context, req *driver.CreateMachineR
 // LastKnownState        bytes(blob)              (Optional) Last known state of VM during the current operation.
 //
 //	Could be helpful to continue operations in future requests.
-func (p *Provider) DeleteMachine(ctx context.Context, req *driver.DeleteMachineRequest) (*driver.DeleteMachineResponse, error) {
-	klog.V(2).Infof("machine deletion request has been received for %q", req.Machine.Name)
-	providerSpec, err := decodeProviderSpecAndSecret(req.MachineClass, req.Secret)
+func (p *Provider) DeleteMachine(ctx context.Context, req *driver.DeleteMachineRequest) (_ *driver.DeleteMachineResponse, err error) {
+	ctx, logger := withLogValues(ctx, machineLogValues(operationDelete, req.Machine)...)
+	logger.V(2).Info("machine deletion request has been received")
+	ctx, span := startSpan(ctx, "DeleteMachine", machineAttributes(req.Machine)...)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx, p.Options.Timeouts.Delete)
+	defer cancel()
+
+	metrics := newOperationMetrics(operationDelete)
+	defer func() { metrics.observe(err) }()
+
+	// unknown fields must not prevent the cleanup of machines whose machine class was created before they were rejected
+	providerSpec, err := decodeProviderSpecAndSecret(ctx, req.MachineClass, req.Secret, p.Options, false)
 	if err != nil {
-		klog.Error(err.Error())
+		logger.Error(err, "invalid provider spec")
 		return nil, err
 	}
+	metrics.withSpec(providerSpec)
+	span.SetAttributes(specAttributes(providerSpec)...)
 
 	clusterIDTag, ok := tag.NewTagMap(providerSpec.Tags).Value(tag.ClusterID)
 	if !ok {
-		klog.V(2).Infof("machine deletion request for machine %q failed because provider spec did not contain metal-stack cluster tag", req.Machine.Name)
-		return nil, status.Error(codes.Internal, "machine deletion request failed because provider spec did not contain metal-stack cluster tag")
+		logger.V(2).Info("machine deletion request failed because provider spec did not contain metal-stack cluster tag")
+		return nil, status.Error(codes.InvalidArgument, "machine deletion request failed because provider spec did not contain metal-stack cluster tag")
 	}
 
+	ctx, logger = withLogValues(ctx, specLogValues(providerSpec, clusterIDTag)...)
+
 	m, err := p.initClient(req.Secret)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to create metal-api client")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	if req.Machine.Spec.ProviderID == "" {
-		klog.Infof("machine has no provider id attached anymore, already deleted and therefore skipping deletion")
+		logger.Info("machine has no provider id attached anymore, already deleted and therefore skipping deletion")
 		return &driver.DeleteMachineResponse{}, nil
 	}
 
@@ -201,27 +398,71 @@ func (p *Provider) DeleteMachine(ctx context.Context, req *driver.DeleteMachineR
 		AllocationRole:    models.V1MachineAllocationRoleMachine,
 	}
 
-	resp, err := m.Machine().FindMachines(machine.NewFindMachinesParams().WithBody(mfr), nil)
+	resp, err := m.Machine().FindMachines(machine.NewFindMachinesParamsWithContext(ctx).WithBody(mfr), nil)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to find machine", "id", id)
+		return nil, metalErrorToStatus(err)
 	}
 
 	switch len(resp.Payload) {
 	case 0:
-		klog.Infof("no machine with id %q found in project %q, already deleted and therefore skipping deletion", id, providerSpec.Project)
+		logger.Info("machine not found in project, already deleted and therefore skipping deletion", "id", id)
 		return &driver.DeleteMachineResponse{}, nil
 	case 1:
-		_, err = m.Machine().FreeMachine(machine.NewFreeMachineParams().WithID(id), nil)
+		// the safety controller lists a recovered machine under the name of its unhealthy machine object until it was adopted,
+		// such a deletion refers to a listing from before the adoption and must not free the machine
+		if name, ok := tag.NewTagMap(resp.Payload[0].Tags).Value(machineNameTagKey); ok && name != req.Machine.Name {
+			logger.Info("machine was adopted by another machine object, skipping deletion", "id", id, "adoptedBy", name)
+			return &driver.DeleteMachineResponse{}, nil
+		}
+
+		if p.Options.RecoveryAction != "" && recoveryAllowed(resp.Payload[0]) {
+			if unhealthy := recoveryRequired(req.Machine, p.Options.RecoveryConditions); len(unhealthy) > 0 {
+				released, err := releaseForRecovery(ctx, m, resp.Payload[0], p.Options.RecoveryAction, time.Now())
+				if err != nil {
+					logger.Error(err, "unable to release machine for recovery", "id", id)
+					return &driver.DeleteMachineResponse{
+						LastKnownState: encodeMachineState(machineStateAllocated, resp.Payload[0]),
+					}, err
+				}
+				logger.Info("released machine for recovery because of unhealthy node conditions", "id", id, "conditions", unhealthy)
+				return &driver.DeleteMachineResponse{
+					LastKnownState: encodeMachineState(machineStateReleasedForRecovery, released),
+				}, nil
+			}
+		}
+
+		// the machine is powered off gracefully before it is freed, which takes several calls until it turned off,
+		// the time the power off was issued is kept in the machine tags and shown in the last known state in the meantime
+		if p.Options.PowerOffGracePeriod > 0 {
+			since, err := powerOffMachine(ctx, m, resp.Payload[0], p.Options.PowerOffGracePeriod, time.Now())
+			if err != nil {
+				logger.V(2).Info("machine is not yet powered off", "id", id, "reason", err.Error())
+				state := newMachineState(machineStateAllocated, resp.Payload[0])
+				if !since.IsZero() {
+					state.State = machineStatePoweringOff
+					state.PowerOffSince = since.UTC().Format(time.RFC3339)
+				}
+				return &driver.DeleteMachineResponse{
+					LastKnownState: state.encode(),
+				}, err
+			}
+		}
+
+		fmr, err := m.Machine().FreeMachine(machine.NewFreeMachineParamsWithContext(ctx).WithID(id), nil)
 
 		if err != nil {
-			klog.Error(err.Error())
-			return nil, status.Error(codes.Internal, err.Error())
+			logger.Error(err, "unable to free machine", "id", id)
+			return &driver.DeleteMachineResponse{
+				LastKnownState: encodeMachineState(machineStateAllocated, resp.Payload[0]),
+			}, metalErrorToStatus(err)
 		}
-		klog.Infof("deleted machine %q (%q)", req.Machine.Name, id)
-		return &driver.DeleteMachineResponse{}, nil
+		logger.Info("deleted machine", "id", id)
+		return &driver.DeleteMachineResponse{
+			LastKnownState: encodeMachineState(machineStateFreed, fmr.Payload),
+		}, nil
 	default:
-		klog.Errorf("error finding machine to delete because more than one search result")
+		logger.Error(nil, "error finding machine to delete because more than one search result", "id", id)
 		return nil, status.Error(codes.Internal, "error finding machine to delete because more than one search result")
 	}
 }
@@ -245,24 +486,41 @@ func (p *Provider) DeleteMachine(ctx context.Context, req *driver.DeleteMachineR
 //	This could be different from req.MachineName as well
 //
 // The request should return a NOT_FOUND (5) status error code if the machine is not existing
-func (p *Provider) GetMachineStatus(ctx context.Context, req *driver.GetMachineStatusRequest) (*driver.GetMachineStatusResponse, error) {
-	klog.V(2).Infof("get request has been received for %q", req.Machine.Name)
-	providerSpec, err := decodeProviderSpecAndSecret(req.MachineClass, req.Secret)
+// and an UNINITIALIZED (17) status error code together with the response if the machine has not finished provisioning.
+// Crash loops and failed machine reclaims are reported as UNINITIALIZED as well, as the machine controller aborts
+// the deletion of a machine on any other code; InitializeMachine reports them as INTERNAL (13).
+// The message contains the recent provisioning events of the machine.
+func (p *Provider) GetMachineStatus(ctx context.Context, req *driver.GetMachineStatusRequest) (_ *driver.GetMachineStatusResponse, err error) {
+	ctx, logger := withLogValues(ctx, machineLogValues(operationGet, req.Machine)...)
+	logger.V(2).Info("get request has been received")
+	ctx, span := startSpan(ctx, "GetMachineStatus", machineAttributes(req.Machine)...)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx, p.Options.Timeouts.Get)
+	defer cancel()
+
+	metrics := newOperationMetrics(operationGet)
+	defer func() { metrics.observe(err) }()
+
+	providerSpec, err := decodeProviderSpecAndSecret(ctx, req.MachineClass, req.Secret, p.Options, false)
 	if err != nil {
-		klog.Error(err.Error())
+		logger.Error(err, "invalid provider spec")
 		return nil, err
 	}
+	metrics.withSpec(providerSpec)
+	span.SetAttributes(specAttributes(providerSpec)...)
 
 	clusterIDTag, ok := tag.NewTagMap(providerSpec.Tags).Value(tag.ClusterID)
 	if !ok {
-		klog.V(2).Infof("get request for machine %q failed because provider spec did not contain metal-stack cluster tag", req.Machine.Name)
-		return nil, status.Error(codes.Internal, "get machine request failed because provider spec did not contain metal-stack cluster tag")
+		logger.V(2).Info("get request failed because provider spec did not contain metal-stack cluster tag")
+		return nil, status.Error(codes.InvalidArgument, "get machine request failed because provider spec did not contain metal-stack cluster tag")
 	}
 
+	ctx, logger = withLogValues(ctx, specLogValues(providerSpec, clusterIDTag)...)
+
 	m, err := p.initClient(req.Secret)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to create metal-api client")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	id := decodeMachineID(req.Machine.Spec.ProviderID)
@@ -271,34 +529,52 @@ func (p *Provider) GetMachineStatus(ctx context.Context, req *driver.GetMachineS
 		return nil, status.Error(codes.NotFound, "machine not found, not yet created")
 	}
 
-	resp, err := m.Machine().FindMachine(machine.NewFindMachineParams().WithID(id), nil)
+	resp, err := m.Machine().FindMachine(machine.NewFindMachineParamsWithContext(ctx).WithID(id), nil)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to find machine", "id", id)
+		return nil, metalErrorToStatus(err)
 	}
 
 	if resp.Payload.Allocation == nil {
-		klog.V(2).Infof("machine already released: %q", req.Machine.Name)
+		logger.V(2).Info("machine already released")
 		return nil, status.Error(codes.NotFound, "machine already released")
 	}
 
 	machineClusterIDTag, ok := tag.NewTagMap(resp.Payload.Tags).Value(tag.ClusterID)
 	if !ok {
-		klog.V(2).Infof("machine has no cluster tag anymore: %q", req.Machine.Name)
+		logger.V(2).Info("machine has no cluster tag anymore")
 		return nil, status.Error(codes.NotFound, "machine has no cluster tag anymore")
 	}
 
 	if machineClusterIDTag != clusterIDTag {
-		klog.V(2).Infof("machine does not belong to this cluster anymore: %q", req.Machine.Name)
+		logger.V(2).Info("machine does not belong to this cluster anymore", "machineClusterID", machineClusterIDTag)
 		return nil, status.Error(codes.NotFound, "machine does not belong to this cluster anymore")
 	}
 
-	klog.V(2).Infof("machine get request has been processed successfully for %q", req.Machine.Name)
-
-	return &driver.GetMachineStatusResponse{
+	response := &driver.GetMachineStatusResponse{
 		ProviderID: encodeMachineID(*resp.Payload.Partition.ID, *resp.Payload.ID),
 		NodeName:   *resp.Payload.Allocation.Name,
-	}, nil
+	}
+
+	// a machine that has not finished provisioning is reported as uninitialized, such that the machine controller
+	// triggers InitializeMachine until it phoned home. The machine controller reads the provider id and node name
+	// of the response along with the uninitialized error, so the response is returned as well.
+	// Crash loops and failed machine reclaims are reported as uninitialized too, the deletion flow of the machine
+	// controller calls this method for machines without node and aborts on any other code, such that the machine
+	// would never be deleted.
+	if err := checkProvisioningEvents(resp.Payload.Events); err != nil {
+		logger.V(2).Info("machine is not yet initialized", "reason", err.Error())
+		s, _ := status.FromError(err)
+		msg := s.Message()
+		if progress := provisioningProgress(resp.Payload.Events); len(progress) > 0 {
+			msg = fmt.Sprintf("%s, provisioning progress: %s", msg, strings.Join(progress, " -> "))
+		}
+		return response, status.Error(codes.Uninitialized, msg)
+	}
+
+	logger.V(2).Info("machine get request has been processed successfully")
+
+	return response, nil
 }
 
 // ListMachines lists all the machines possibilly created by a providerSpec
@@ -314,38 +590,52 @@ func (p *Provider) GetMachineStatus(ctx context.Context, req *driver.GetMachineS
 // MachineList           map<string,string>  A map containing the keys as the MachineID and value as the MachineName
 //
 //	for all machine's who where possibilly created by this ProviderSpec
-func (p *Provider) ListMachines(ctx context.Context, req *driver.ListMachinesRequest) (*driver.ListMachinesResponse, error) {
-	klog.V(2).Infof("list machines request has been received for %q", req.MachineClass.Name)
-	providerSpec, err := decodeProviderSpecAndSecret(req.MachineClass, req.Secret)
+func (p *Provider) ListMachines(ctx context.Context, req *driver.ListMachinesRequest) (_ *driver.ListMachinesResponse, err error) {
+	ctx, logger := withLogValues(ctx, logKeyOperation, operationList, logKeyMachineClass, klog.KObj(req.MachineClass))
+	logger.V(2).Info("list machines request has been received")
+	ctx, span := startSpan(ctx, "ListMachines", machineClassNameAttributeKey.String(req.MachineClass.Name))
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx, p.Options.Timeouts.List)
+	defer cancel()
+
+	metrics := newOperationMetrics(operationList)
+	defer func() { metrics.observe(err) }()
+
+	providerSpec, err := decodeProviderSpecAndSecret(ctx, req.MachineClass, req.Secret, p.Options, false)
 	if err != nil {
-		klog.Error(err.Error())
+		logger.Error(err, "invalid provider spec")
 		return nil, err
 	}
+	metrics.withSpec(providerSpec)
+	span.SetAttributes(specAttributes(providerSpec)...)
 
 	m, err := p.initClient(req.Secret)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to create metal-api client")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	listOfVMs := make(map[string]string)
 
 	clusterIDTag, ok := tag.NewTagMap(providerSpec.Tags).Value(tag.ClusterID)
 	if !ok {
-		klog.V(2).Infof("list machines request failed because provider spec did not contain metal-stack cluster tag for %q", req.MachineClass.Name)
-		return nil, status.Error(codes.Internal, "list machines request failed because provider spec did not contain metal-stack cluster tag")
+		logger.V(2).Info("list machines request failed because provider spec did not contain metal-stack cluster tag")
+		return nil, status.Error(codes.InvalidArgument, "list machines request failed because provider spec did not contain metal-stack cluster tag")
 	}
 
+	ctx, logger = withLogValues(ctx, specLogValues(providerSpec, clusterIDTag)...)
+
 	findRequest := &models.V1MachineFindRequest{
 		AllocationProject: providerSpec.Project,
 		Tags:              []string{fmt.Sprintf("%s=%s", tag.ClusterID, clusterIDTag)},
 	}
-	resp, err := m.Machine().FindMachines(machine.NewFindMachinesParams().WithBody(findRequest), nil)
+	resp, err := m.Machine().FindMachines(machine.NewFindMachinesParamsWithContext(ctx).WithBody(findRequest), nil)
 	if err != nil {
-		klog.Error(err.Error())
-		return nil, status.Error(codes.Internal, err.Error())
+		logger.Error(err, "unable to find machines")
+		return nil, metalErrorToStatus(err)
 	}
 
+	now := time.Now()
 	for _, m := range resp.Payload {
 		if m.ID == nil || m.Allocation == nil || m.Allocation.Role == nil || m.Partition == nil || m.Partition.ID == nil || *m.Partition.ID == "" {
 			return nil, status.Error(codes.Internal, "machine response contains invalid fields")
@@ -355,11 +645,21 @@ func (p *Provider) ListMachines(ctx context.Context, req *driver.ListMachinesReq
 			continue
 		}
 
+		// machines released for recovery are not listed as orphans until they exceeded the recovery timeout
+		if p.Options.RecoveryAction != "" && recoveryPending(m, p.Options.RecoveryTimeout, now) {
+			continue
+		}
+
+		name := *m.Allocation.Hostname
+		if adoptedBy, ok := tag.NewTagMap(m.Tags).Value(machineNameTagKey); ok {
+			name = adoptedBy
+		}
+
 		providerID := encodeMachineID(*m.Partition.ID, *m.ID)
-		listOfVMs[providerID] = *m.Allocation.Hostname
+		listOfVMs[providerID] = name
 	}
 
-	klog.V(2).Infof("list machines request has been processed successfully for %q, found %v", req.MachineClass.Name, listOfVMs)
+	logger.V(2).Info("list machines request has been processed successfully", "machines", len(listOfVMs))
 
 	return &driver.ListMachinesResponse{MachineList: listOfVMs}, nil
 }
@@ -371,9 +671,9 @@ func (p *Provider) ListMachines(ctx context.Context, req *driver.ListMachinesReq
 //
 // RESPONSE PARAMETERS (driver.GetVolumeIDsResponse)
 // VolumeIDs             []string                             VolumeIDs is a repeated list of VolumeIDs.
-func (p *Provider) GetVolumeIDs(_ context.Context, req *driver.GetVolumeIDsRequest) (*driver.GetVolumeIDsResponse, error) {
-	// Log messages to track start and end of request
-	klog.V(2).Infof("GetVolumeIDs request has been received for %q", req.PVSpecs)
+func (p *Provider) GetVolumeIDs(ctx context.Context, req *driver.GetVolumeIDsRequest) (*driver.GetVolumeIDsResponse, error) {
+	logger := klog.FromContext(ctx).WithValues(logKeyOperation, operationGetVolumeIDs)
+	logger.V(2).Info("GetVolumeIDs request has been received", "pvSpecs", len(req.PVSpecs))
 
 	var (
 		volumeIDs []string
@@ -402,7 +702,7 @@ func (p *Provider) GetVolumeIDs(_ context.Context, req *driver.GetVolumeIDsReque
 				continue
 			}
 
-			klog.Errorf("invalid lightbits volumeHandle (missing nguid): %s", spec.CSI.VolumeHandle)
+			logger.Error(nil, "invalid lightbits volume handle, missing nguid", "volumeHandle", spec.CSI.VolumeHandle)
 
 			fallthrough
 		default:
@@ -410,7 +710,7 @@ func (p *Provider) GetVolumeIDs(_ context.Context, req *driver.GetVolumeIDsReque
 		}
 	}
 
-	klog.V(2).Infof("GetVolumeIDs request has been processed successfully for %q", req.PVSpecs)
+	logger.V(2).Info("GetVolumeIDs request has been processed successfully", "volumeIDs", volumeIDs)
 
 	return &driver.GetVolumeIDsResponse{VolumeIDs: volumeIDs}, nil
 }
@@ -438,7 +738,68 @@ func (p *Provider) GenerateMachineClassForMigration(ctx context.Context, req *dr
 	return nil, fmt.Errorf("machineclass migration is not supported anymore")
 }
 
-// InitializeMachine handles VM initialization for openstack VM's. Currently, un-implemented.
-func (p *Provider) InitializeMachine(_ context.Context, _ *driver.InitializeMachineRequest) (*driver.InitializeMachineResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "metal-stack does not implement InitializeMachine")
+// InitializeMachine handles VM initialization
+//
+// REQUEST PARAMETERS (driver.InitializeMachineRequest)
+// Machine               *v1alpha1.Machine        Machine object representing the VM that must be initialized
+// MachineClass          *v1alpha1.MachineClass   MachineClass backing the machine object
+// Secret                *corev1.Secret           Kubernetes secret that contains any sensitive data/credentials
+//
+// RESPONSE PARAMETERS (driver.InitializeMachineResponse)
+// ProviderID            string                   Unique identification of the VM at the cloud provider.
+// NodeName              string                   Returns the name of the node-object that the VM register's with Kubernetes.
+//
+// The request returns an UNINITIALIZED (17) status error code as long as the machine has not finished provisioning,
+// i.e. it did not phone home yet. Crash loops and failed machine reclaims are reported as INTERNAL (13).
+func (p *Provider) InitializeMachine(ctx context.Context, req *driver.InitializeMachineRequest) (_ *driver.InitializeMachineResponse, err error) {
+	ctx, logger := withLogValues(ctx, machineLogValues(operationInitialize, req.Machine)...)
+	logger.V(2).Info("machine initialization request has been received")
+	ctx, span := startSpan(ctx, "InitializeMachine", machineAttributes(req.Machine)...)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx, p.Options.Timeouts.Initialize)
+	defer cancel()
+
+	providerSpec, err := decodeProviderSpecAndSecret(ctx, req.MachineClass, req.Secret, p.Options, !p.Options.WarnUnknownFields)
+	if err != nil {
+		logger.Error(err, "invalid provider spec")
+		return nil, err
+	}
+	span.SetAttributes(specAttributes(providerSpec)...)
+	ctx, logger = withLogValues(ctx, specLogValues(providerSpec, "")...)
+
+	m, err := p.initClient(req.Secret)
+	if err != nil {
+		logger.Error(err, "unable to create metal-api client")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	id := decodeMachineID(req.Machine.Spec.ProviderID)
+
+	if id == "" {
+		return nil, status.Error(codes.NotFound, "machine not found, not yet created")
+	}
+
+	resp, err := m.Machine().FindMachine(machine.NewFindMachineParamsWithContext(ctx).WithID(id), nil)
+	if err != nil {
+		logger.Error(err, "unable to find machine", "id", id)
+		return nil, metalErrorToStatus(err)
+	}
+
+	if resp.Payload.Allocation == nil {
+		logger.V(2).Info("machine already released")
+		return nil, status.Error(codes.NotFound, "machine already released")
+	}
+
+	err = checkProvisioningEvents(resp.Payload.Events)
+	if err != nil {
+		logger.V(2).Info("machine is not yet initialized", "reason", err.Error())
+		return nil, err
+	}
+
+	logger.V(2).Info("machine initialization request has been processed successfully")
+
+	return &driver.InitializeMachineResponse{
+		ProviderID: encodeMachineID(*resp.Payload.Partition.ID, *resp.Payload.ID),
+		NodeName:   *resp.Payload.Allocation.Name,
+	}, nil
 }
@@ -3,11 +3,26 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	"github.com/google/go-cmp/cmp"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/spi/fake"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"github.com/metal-stack/metal-lib/pkg/tag"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func TestProvider_GetVolumeIDs(t *testing.T) {
@@ -71,3 +86,1145 @@ func TestProvider_GetVolumeIDs(t *testing.T) {
 		})
 	}
 }
+
+const (
+	testClusterID = "a-cluster"
+	testPartition = "a-partition"
+	testProject   = "a-project"
+	testSize      = "c1-xlarge-x86"
+)
+
+func testMachineClass(t *testing.T, mutate func(spec *api.MetalProviderSpec)) *v1alpha1.MachineClass {
+	spec := &api.MetalProviderSpec{
+		Partition: testPartition,
+		Size:      testSize,
+		Image:     "ubuntu-24.4",
+		Project:   testProject,
+		Network:   "a-network",
+		Tags:      []string{tag.New(tag.ClusterID, testClusterID)},
+	}
+	if mutate != nil {
+		mutate(spec)
+	}
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("unable to marshal provider spec: %v", err)
+	}
+
+	return &v1alpha1.MachineClass{
+		ObjectMeta:   metav1.ObjectMeta{Name: "a-machine-class"},
+		ProviderSpec: runtime.RawExtension{Raw: raw},
+	}
+}
+
+func testSecret() *corev1.Secret {
+	return &corev1.Secret{
+		Data: map[string][]byte{
+			"metalAPIURL": []byte("http://metal-api"),
+			"metalAPIKey": []byte("a-token"),
+			"userData":    []byte("#cloud-config"),
+		},
+	}
+}
+
+func testMachine(providerID string) *v1alpha1.Machine {
+	return &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-machine", UID: "a-uid"},
+		Spec:       v1alpha1.MachineSpec{ProviderID: providerID},
+	}
+}
+
+// otherAllocatedMachine returns a machine of the project which was allocated for another machine object
+func otherAllocatedMachine(id string) *models.V1MachineResponse {
+	m := allocatedMachine(id)
+	m.Tags = []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "another-uid")}
+	return m
+}
+
+func testSizeReservation(amount int32) *models.V1SizeReservationResponse {
+	return &models.V1SizeReservationResponse{
+		ID:           pointer.Pointer("a-reservation"),
+		Amount:       pointer.Pointer(amount),
+		Partitionids: []string{testPartition},
+		Projectid:    pointer.Pointer(testProject),
+		Sizeid:       pointer.Pointer(testSize),
+	}
+}
+
+func testImages() []*models.V1ImageResponse {
+	return []*models.V1ImageResponse{
+		{ID: pointer.Pointer("ubuntu-24.4.20240101")},
+		{ID: pointer.Pointer("ubuntu-24.4.20240315")},
+		{ID: pointer.Pointer("ubuntu-24.10.20241015"), Classification: "preview"},
+		{ID: pointer.Pointer("debian-12.0.20240315")},
+	}
+}
+
+func allocatedMachine(id string, events ...string) *models.V1MachineResponse {
+	m := fake.NewMachine(id, testPartition, testSize)
+	m.Tags = []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid")}
+	m.Allocation = &models.V1MachineAllocation{
+		Name:     pointer.Pointer("a-machine"),
+		Hostname: pointer.Pointer("a-machine"),
+		Project:  pointer.Pointer(testProject),
+		Role:     pointer.Pointer(models.V1MachineAllocationRoleMachine),
+	}
+	if len(events) > 0 {
+		m.Events = &models.V1MachineRecentProvisioningEvents{}
+		for _, e := range events {
+			m.Events.Log = append(m.Events.Log, &models.V1MachineProvisioningEvent{Event: pointer.Pointer(e)})
+		}
+	}
+	return m
+}
+
+// releasedMachine returns a machine that was released for recovery at the given time by the deletion of another machine object of the given machine class
+func releasedMachine(id, machineClass string, action RecoveryAction, releasedAt time.Time) *models.V1MachineResponse {
+	m := allocatedMachine(id, "Phoned Home")
+	m.Tags = []string{
+		tag.New(tag.ClusterID, testClusterID),
+		tag.New(machineClassTagKey, machineClass),
+		tag.New(machineRecoveryTagKey, string(action)),
+		tag.New(machineReleasedTagKey, releasedAt.UTC().Format(time.RFC3339)),
+	}
+	m.Allocation.Name = pointer.Pointer("an-unhealthy-machine")
+	m.Allocation.Hostname = pointer.Pointer("an-unhealthy-machine")
+	m.Allocation.Image = &models.V1ImageResponse{ID: pointer.Pointer("ubuntu-24.4.20240315")}
+	m.Allocation.UserData = "#cloud-config\nbootstrap-token: an-unhealthy-machine-token"
+	return m
+}
+
+func TestProvider_CreateMachine(t *testing.T) {
+	tests := []struct {
+		name         string
+		api          *fake.MetalAPI
+		spiErr       error
+		opts         Options
+		mutate       func(spec *api.MetalProviderSpec)
+		want         *driver.CreateMachineResponse
+		wantErr      error
+		wantMachines []string
+		check        func(t *testing.T, api *fake.MetalAPI)
+	}{
+		{
+			name: "allocate a free machine",
+			api:  fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m1",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1"},
+		},
+		{
+			name: "return already allocated machine",
+			api:  fake.NewMetalAPI(allocatedMachine("m1"), fake.NewMachine("m2", testPartition, testSize)),
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m1",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1"},
+		},
+		{
+			name: "allocate pinned machine candidates in order",
+			api: fake.NewMetalAPI(
+				fake.NewMachine("00000000-0000-0000-0000-000000000001", testPartition, testSize),
+				fake.NewMachine("00000000-0000-0000-0000-000000000002", testPartition, testSize),
+			),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.MachineIDs = []string{"00000000-0000-0000-0000-000000000003", "00000000-0000-0000-0000-000000000002"}
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/00000000-0000-0000-0000-000000000002",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"00000000-0000-0000-0000-000000000002","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"00000000-0000-0000-0000-000000000002"},
+		},
+		{
+			name: "allocated pinned machine candidate is skipped",
+			api: fake.NewMetalAPI(
+				otherAllocatedMachine("00000000-0000-0000-0000-000000000001"),
+				fake.NewMachine("00000000-0000-0000-0000-000000000002", testPartition, testSize),
+			),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.MachineIDs = []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/00000000-0000-0000-0000-000000000002",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"00000000-0000-0000-0000-000000000002","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"},
+		},
+		{
+			name: "pinned machine candidates are not tried further on server errors",
+			api: fake.NewMetalAPI(
+				fake.NewMachine("00000000-0000-0000-0000-000000000001", testPartition, testSize),
+				fake.NewMachine("00000000-0000-0000-0000-000000000002", testPartition, testSize),
+			).WithError("AllocateMachine", fake.HTTPError(http.StatusInternalServerError, "allocation failed")),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.MachineIDs = []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+			},
+			wantErr: status.Error(codes.Internal, "allocation failed"),
+		},
+		{
+			name: "apply defaults of flags and partition",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithPartitions(&models.V1PartitionResponse{
+				ID:         pointer.Pointer(testPartition),
+				DNSServers: []*models.V1DNSServer{{IP: pointer.Pointer("1.1.1.1")}},
+				NtpServers: []*models.V1NTPServer{{Address: pointer.Pointer("0.de.pool.ntp.org")}},
+			}),
+			opts: Options{
+				DefaultImage:      "debian-12",
+				DefaultNTPServers: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+				PartitionDefaults: true,
+			},
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.Image = ""
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m1",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				alloc := api.Machine("m1").Allocation
+				if diff := cmp.Diff("debian-12.0.20240315", pointer.SafeDeref(alloc.Image.ID)); diff != "" {
+					t.Errorf("image diff = %s", diff)
+				}
+				if diff := cmp.Diff([]*models.V1DNSServer{{IP: pointer.Pointer("1.1.1.1")}}, alloc.DNSServers); diff != "" {
+					t.Errorf("dns servers diff = %s", diff)
+				}
+				if diff := cmp.Diff([]*models.V1NTPServer{{Address: pointer.Pointer("10.0.0.1")}, {Address: pointer.Pointer("10.0.0.2")}, {Address: pointer.Pointer("10.0.0.3")}}, alloc.NtpServers); diff != "" {
+					t.Errorf("ntp servers diff = %s", diff)
+				}
+			},
+		},
+		{
+			name:    "partition of the defaults does not exist",
+			api:     fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			opts:    Options{PartitionDefaults: true},
+			wantErr: status.Error(codes.NotFound, "partition a-partition does not exist"),
+		},
+		{
+			name:    "no free machine",
+			api:     fake.NewMetalAPI(fake.NewMachine("m1", testPartition, "another-size")),
+			wantErr: status.Error(codes.ResourceExhausted, "no machine available"),
+		},
+		{
+			name: "capacity check with free machines",
+			api:  fake.NewMetalAPI(otherAllocatedMachine("m1"), fake.NewMachine("m2", testPartition, testSize)),
+			opts: Options{CapacityCheck: true},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+		},
+		{
+			name:    "capacity check without free machines",
+			api:     fake.NewMetalAPI(fake.NewMachine("m1", testPartition, "another-size")),
+			opts:    Options{CapacityCheck: true},
+			wantErr: status.Error(codes.ResourceExhausted, "0 free c1-xlarge-x86 machines in partition a-partition"),
+		},
+		{
+			name: "required size reservation with reserved machines left",
+			api: fake.NewMetalAPI(otherAllocatedMachine("m1"), fake.NewMachine("m2", testPartition, testSize)).
+				WithSizeReservations(testSizeReservation(2)),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.SizeReservationPolicy = api.SizeReservationPolicyRequired
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+		},
+		{
+			name: "required size reservation is exhausted",
+			api: fake.NewMetalAPI(otherAllocatedMachine("m1"), fake.NewMachine("m2", testPartition, testSize)).
+				WithSizeReservations(testSizeReservation(1)),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.SizeReservationPolicy = api.SizeReservationPolicyRequired
+			},
+			wantErr:      status.Error(codes.FailedPrecondition, "size reservation of project a-project for c1-xlarge-x86 machines in partition a-partition is exhausted, 1 of 1 reserved machines are allocated"),
+			wantMachines: []string{"m1"},
+		},
+		{
+			name: "required size reservation does not exist",
+			api:  fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.SizeReservationPolicy = api.SizeReservationPolicyRequired
+			},
+			wantErr: status.Error(codes.FailedPrecondition, "project a-project has no size reservation for c1-xlarge-x86 machines in partition a-partition"),
+		},
+		{
+			name: "preferred size reservation is exhausted",
+			api: fake.NewMetalAPI(otherAllocatedMachine("m1"), fake.NewMachine("m2", testPartition, testSize)).
+				WithSizeReservations(testSizeReservation(1)),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.SizeReservationPolicy = api.SizeReservationPolicyPreferred
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+		},
+		{
+			name: "allocate with fallback size and partition",
+			api: fake.NewMetalAPI(
+				fake.NewMachine("m1", testPartition, "c1-medium-x86"),
+				fake.NewMachine("m2", "b-partition", "c1-large-x86"),
+			),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FallbackSizes = []string{"c1-large-x86"}
+				spec.FallbackPartitions = []string{"b-partition"}
+				spec.FallbackNetworks = []api.PartitionNetworks{{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}}}}
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///b-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"b-partition","fallback":"b-partition/c1-large-x86"}`,
+			},
+			wantMachines: []string{"m2"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if !slices.Contains(api.Machine("m2").Tags, "machine.metal-stack.io/allocation-fallback=b-partition/c1-large-x86") {
+					t.Errorf("expected fallback to be recorded in the machine tags, got %v", api.Machine("m2").Tags)
+				}
+			},
+		},
+		{
+			name: "allocate with the networks of the fallback partition",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", "b-partition", testSize)).WithNetworks(
+				&models.V1NetworkResponse{ID: pointer.Pointer("a-network"), Partitionid: testPartition},
+				&models.V1NetworkResponse{ID: pointer.Pointer("b-network"), Partitionid: "b-partition"},
+				&models.V1NetworkResponse{ID: pointer.Pointer("internet")},
+			),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FallbackPartitions = []string{"b-partition"}
+				spec.FallbackNetworks = []api.PartitionNetworks{{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}, {ID: "internet"}}}}
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///b-partition/m1",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"b-partition","fallback":"b-partition/c1-xlarge-x86"}`,
+			},
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				want := []*models.V1MachineNetwork{{Networkid: pointer.Pointer("b-network")}, {Networkid: pointer.Pointer("internet")}}
+				if diff := cmp.Diff(want, api.Machine("m1").Allocation.Networks); diff != "" {
+					t.Errorf("networks diff = %s", diff)
+				}
+			},
+		},
+		{
+			name: "fallback partition without its own networks is rejected",
+			api:  fake.NewMetalAPI(fake.NewMachine("m1", "b-partition", testSize)),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FallbackPartitions = []string{"b-partition"}
+			},
+			wantErr: status.Error(codes.InvalidArgument, `error while validating ProviderSpec: providerSpec.fallbackPartitions[0]: Required value: networks of fallback partition "b-partition" are required in fallbackNetworks, as private networks belong to a single partition`),
+		},
+		{
+			name: "apply defaults of the fallback partition",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", "b-partition", testSize)).WithPartitions(
+				&models.V1PartitionResponse{
+					ID:         pointer.Pointer(testPartition),
+					DNSServers: []*models.V1DNSServer{{IP: pointer.Pointer("1.1.1.1")}},
+				},
+				&models.V1PartitionResponse{
+					ID:         pointer.Pointer("b-partition"),
+					DNSServers: []*models.V1DNSServer{{IP: pointer.Pointer("8.8.8.8")}},
+				},
+			),
+			opts: Options{PartitionDefaults: true},
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FallbackPartitions = []string{"b-partition"}
+				spec.FallbackNetworks = []api.PartitionNetworks{{Partition: "b-partition", Networks: []api.Network{{ID: "b-network"}}}}
+			},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///b-partition/m1",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"b-partition","fallback":"b-partition/c1-xlarge-x86"}`,
+			},
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if diff := cmp.Diff([]*models.V1DNSServer{{IP: pointer.Pointer("8.8.8.8")}}, api.Machine("m1").Allocation.DNSServers); diff != "" {
+					t.Errorf("dns servers diff = %s", diff)
+				}
+			},
+		},
+		{
+			name: "invalid defaults of the partition",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithPartitions(&models.V1PartitionResponse{
+				ID:         pointer.Pointer(testPartition),
+				DNSServers: []*models.V1DNSServer{{IP: pointer.Pointer("1.1.1.300")}},
+				NtpServers: []*models.V1NTPServer{{Address: pointer.Pointer("0.de.pool.ntp.org")}},
+			}),
+			opts:    Options{PartitionDefaults: true},
+			wantErr: status.Error(codes.InvalidArgument, `error while validating the defaults of partition "a-partition": partition[a-partition].dnsServers[0].ip: Invalid value: "1.1.1.300": must be a valid ip address, partition[a-partition].ntpServers: Invalid value: 1: must contain between 3 and 5 ntp servers`),
+		},
+		{
+			name: "no capacity for all fallbacks",
+			api:  fake.NewMetalAPI(fake.NewMachine("m1", testPartition, "c1-medium-x86")),
+			opts: Options{CapacityCheck: true},
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FallbackSizes = []string{"c1-large-x86"}
+			},
+			wantErr: status.Error(codes.ResourceExhausted, "a-partition/c1-xlarge-x86: 0 free c1-xlarge-x86 machines in partition a-partition, a-partition/c1-large-x86: 0 free c1-large-x86 machines in partition a-partition"),
+		},
+		{
+			name: "recover machine released for recovery with a reset",
+			api:  fake.NewMetalAPI(releasedMachine("m1", "a-machine-class", RecoveryActionReset, time.Now()), fake.NewMachine("m2", testPartition, testSize)),
+			opts: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m1",
+				NodeName:       "an-unhealthy-machine",
+				LastKnownState: `{"state":"Recovering","id":"m1","partition":"a-partition","recovery":"reset","lastEvent":"Phoned Home","progress":["Phoned Home"]}`,
+			},
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if diff := cmp.Diff([]string{"reset m1"}, api.PowerActions()); diff != "" {
+					t.Errorf("power actions diff = %s", diff)
+				}
+				want := []string{
+					tag.New(tag.ClusterID, testClusterID),
+					tag.New(machineClassTagKey, "a-machine-class"),
+					tag.New(machineIdentityTagKey, "a-uid"),
+					tag.New(machineNameTagKey, "a-machine"),
+					tag.New(machineRecoveredTagKey, "reset"),
+				}
+				if diff := cmp.Diff(want, api.Machine("m1").Tags); diff != "" {
+					t.Errorf("tags diff = %s", diff)
+				}
+				// the machine is neither freed nor reinstalled
+				alloc := api.Machine("m1").Allocation
+				if diff := cmp.Diff("an-unhealthy-machine", pointer.SafeDeref(alloc.Hostname)); diff != "" {
+					t.Errorf("hostname diff = %s", diff)
+				}
+				if diff := cmp.Diff("#cloud-config\nbootstrap-token: an-unhealthy-machine-token", alloc.UserData); diff != "" {
+					t.Errorf("user data diff = %s", diff)
+				}
+			},
+		},
+		{
+			name: "recover machine released for recovery with a reinstall",
+			api:  fake.NewMetalAPI(releasedMachine("m1", "a-machine-class", RecoveryActionReinstall, time.Now())),
+			opts: Options{RecoveryAction: RecoveryActionReinstall, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m1",
+				NodeName:       "an-unhealthy-machine",
+				LastKnownState: `{"state":"Recovering","id":"m1","partition":"a-partition","recovery":"reinstall"}`,
+			},
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if len(api.PowerActions()) > 0 {
+					t.Errorf("expected no power actions, got %v", api.PowerActions())
+				}
+				m := api.Machine("m1")
+				if m.Allocation == nil {
+					t.Fatalf("expected machine to stay allocated")
+				}
+				if diff := cmp.Diff("ubuntu-24.4.20240315", pointer.SafeDeref(m.Allocation.Image.ID)); diff != "" {
+					t.Errorf("image diff = %s", diff)
+				}
+				if m.Events != nil {
+					t.Errorf("expected machine to provision again, got events %v", m.Events)
+				}
+			},
+		},
+		{
+			name: "machine released for recovery by another machine class is not recovered",
+			api: fake.NewMetalAPI(
+				releasedMachine("m1", "another-machine-class", RecoveryActionReset, time.Now()),
+				fake.NewMachine("m2", testPartition, testSize),
+			),
+			opts: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+		},
+		{
+			name: "machine released for recovery is not recovered after the recovery timeout",
+			api: fake.NewMetalAPI(
+				releasedMachine("m1", "a-machine-class", RecoveryActionReset, time.Now().Add(-time.Hour)),
+				fake.NewMachine("m2", testPartition, testSize),
+			),
+			opts: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if len(api.PowerActions()) > 0 {
+					t.Errorf("expected no power actions, got %v", api.PowerActions())
+				}
+			},
+		},
+		{
+			name: "recovery fails if the machine was freed during the adoption",
+			api: fake.NewMetalAPI(releasedMachine("m1", "a-machine-class", RecoveryActionReinstall, time.Now())).
+				WithError("ReinstallMachine", fake.HTTPError(http.StatusUnprocessableEntity, "machine m1 is not allocated")),
+			opts:         Options{RecoveryAction: RecoveryActionReinstall, RecoveryTimeout: 10 * time.Minute},
+			wantErr:      status.Error(codes.InvalidArgument, "machine m1 is not allocated"),
+			wantMachines: []string{"m1"},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if _, ok := tag.NewTagMap(api.Machine("m1").Tags).Value(machineIdentityTagKey); ok {
+					t.Errorf("expected machine not to be adopted")
+				}
+			},
+		},
+		{
+			name: "machine released for recovery is not recovered without recovery mode",
+			api: fake.NewMetalAPI(
+				releasedMachine("m1", "a-machine-class", RecoveryActionReset, time.Now()),
+				fake.NewMachine("m2", testPartition, testSize),
+			),
+			want: &driver.CreateMachineResponse{
+				ProviderID:     "metal:///a-partition/m2",
+				NodeName:       "a-machine",
+				LastKnownState: `{"state":"Allocated","id":"m2","partition":"a-partition"}`,
+			},
+			wantMachines: []string{"m1", "m2"},
+		},
+		{
+			name: "deprecated image",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithImages(&models.V1ImageResponse{
+				ID:             pointer.Pointer("ubuntu-22.4.20240101"),
+				Classification: "deprecated",
+			}),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.Image = "ubuntu-22.04"
+			},
+			wantErr: status.Error(codes.InvalidArgument, `no usable image found for "ubuntu-22.04": ubuntu-22.4.20240101 is deprecated`),
+		},
+		{
+			name: "incompatible filesystem layout",
+			api: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithFilesystemLayouts(&models.V1FilesystemLayoutResponse{
+				ID: pointer.Pointer("a-layout"),
+				Constraints: &models.V1FilesystemLayoutConstraints{
+					Sizes:  []string{"another-size"},
+					Images: map[string]string{"ubuntu": "*"},
+				},
+			}),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.FilesystemLayout = "a-layout"
+				spec.VerifyFilesystemLayout = true
+			},
+			wantErr: status.Error(codes.InvalidArgument, `filesystem layout "a-layout" is not compatible with size "c1-xlarge-x86" and image "ubuntu-24.4.20240315"`),
+		},
+		{
+			name: "invalid provider spec",
+			api:  fake.NewMetalAPI(),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.Image = ""
+				spec.Networks = []api.Network{{ID: ""}}
+			},
+			wantErr: status.Error(codes.InvalidArgument, "error while validating ProviderSpec: providerSpec.image: Required value: image is required, providerSpec.networks: Forbidden: network and networks are mutually exclusive, providerSpec.networks[0].id: Required value: network id is required"),
+		},
+		{
+			name: "missing cluster tag",
+			api:  fake.NewMetalAPI(),
+			mutate: func(spec *api.MetalProviderSpec) {
+				spec.Tags = nil
+			},
+			wantErr: status.Error(codes.InvalidArgument, "machine create request failed because provider spec did not contain metal-stack cluster tag"),
+		},
+		{
+			name:    "metal-api unavailable",
+			api:     fake.NewMetalAPI().WithError("FindMachines", fake.HTTPError(http.StatusServiceUnavailable, "metal-api is unavailable")),
+			wantErr: status.Error(codes.Unavailable, "metal-api is unavailable"),
+		},
+		{
+			name:    "invalid client configuration",
+			api:     fake.NewMetalAPI(),
+			spiErr:  fmt.Errorf("invalid url"),
+			wantErr: status.Error(codes.InvalidArgument, "invalid url"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: tt.api.WithImages(testImages()...), Err: tt.spiErr}, Options: tt.opts}
+
+			got, err := p.CreateMachine(context.Background(), &driver.CreateMachineRequest{
+				Machine:      testMachine(""),
+				MachineClass: testMachineClass(t, tt.mutate),
+				Secret:       testSecret(),
+			})
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+
+			var allocated []string
+			for _, m := range tt.api.Machines() {
+				if m.Allocation != nil {
+					allocated = append(allocated, *m.ID)
+				}
+			}
+			if diff := cmp.Diff(tt.wantMachines, allocated); diff != "" {
+				t.Errorf("allocated machines diff = %s", diff)
+			}
+
+			if tt.check != nil {
+				tt.check(t, tt.api)
+			}
+		})
+	}
+}
+
+func TestProvider_DeleteMachine(t *testing.T) {
+	tests := []struct {
+		name       string
+		api        *fake.MetalAPI
+		providerID string
+		opts       Options
+		conditions []corev1.NodeCondition
+		want       *driver.DeleteMachineResponse
+		wantErr    error
+		check      func(t *testing.T, api *fake.MetalAPI)
+	}{
+		{
+			name:       "free machine",
+			api:        fake.NewMetalAPI(allocatedMachine("m1", "Phoned Home")),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Freed","id":"m1","partition":"a-partition","lastEvent":"Phoned Home","progress":["Phoned Home"]}`,
+			},
+		},
+		{
+			name:       "machine without provider id",
+			api:        fake.NewMetalAPI(),
+			providerID: "",
+			want:       &driver.DeleteMachineResponse{},
+		},
+		{
+			name:       "machine already freed",
+			api:        fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			providerID: "metal:///a-partition/m1",
+			want:       &driver.DeleteMachineResponse{},
+		},
+		{
+			name:       "free fails",
+			api:        fake.NewMetalAPI(allocatedMachine("m1")).WithError("FreeMachine", fake.HTTPError(http.StatusInternalServerError, "free failed")),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"a-partition"}`,
+			},
+			wantErr: status.Error(codes.Internal, "free failed"),
+		},
+		{
+			name:       "free powered off machine",
+			api:        fake.NewMetalAPI(allocatedMachine("m1")).WithPowerState("m1", "OFF"),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{PowerOffGracePeriod: 5 * time.Minute},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Freed","id":"m1","partition":"a-partition"}`,
+			},
+		},
+		{
+			name:       "power off before freeing fails",
+			api:        fake.NewMetalAPI(allocatedMachine("m1")).WithError("MachineOff", fake.HTTPError(http.StatusServiceUnavailable, "bmc is unreachable")),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{PowerOffGracePeriod: 5 * time.Minute},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Allocated","id":"m1","partition":"a-partition"}`,
+			},
+			wantErr: status.Error(codes.Unavailable, "bmc is unreachable"),
+		},
+		{
+			// the safety controller deletes orphaned machines without last known state
+			name:       "free machine that did not power off within the grace period",
+			api:        fake.NewMetalAPI(poweringOffMachine("m1", "2024-05-01T12:00:00Z")),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{PowerOffGracePeriod: 5 * time.Minute},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Freed","id":"m1","partition":"a-partition"}`,
+			},
+		},
+		{
+			name:       "release unhealthy machine for recovery",
+			api:        fake.NewMetalAPI(allocatedMachine("m1", "Phoned Home")),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{RecoveryAction: RecoveryActionReset, RecoveryConditions: []string{"Ready", "KernelDeadlock"}, RecoveryTimeout: 10 * time.Minute},
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: "KernelDeadlock", Status: corev1.ConditionTrue},
+			},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"ReleasedForRecovery","id":"m1","partition":"a-partition","recovery":"reset","lastEvent":"Phoned Home","progress":["Phoned Home"]}`,
+			},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				m := api.Machine("m1")
+				if m.Allocation == nil {
+					t.Errorf("expected machine to stay allocated")
+				}
+				want := []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineRecoveryTagKey, "reset")}
+				if diff := cmp.Diff(want, m.Tags[:2]); diff != "" {
+					t.Errorf("tags diff = %s", diff)
+				}
+				if !recoveryPending(m, 10*time.Minute, time.Now()) {
+					t.Errorf("expected machine to be pending for recovery, got tags %v", m.Tags)
+				}
+			},
+		},
+		{
+			name:       "free healthy machine in recovery mode",
+			api:        fake.NewMetalAPI(allocatedMachine("m1")),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{RecoveryAction: RecoveryActionReset},
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: "KernelDeadlock", Status: corev1.ConditionTrue},
+			},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Freed","id":"m1","partition":"a-partition"}`,
+			},
+		},
+		{
+			name: "skip deletion of a machine adopted by another machine object",
+			api: fake.NewMetalAPI(func() *models.V1MachineResponse {
+				m := allocatedMachine("m1")
+				m.Tags = append(m.Tags, tag.New(machineNameTagKey, "another-machine"), tag.New(machineRecoveredTagKey, "reset"))
+				return m
+			}()),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want:       &driver.DeleteMachineResponse{},
+			check: func(t *testing.T, api *fake.MetalAPI) {
+				if api.Machine("m1").Allocation == nil {
+					t.Errorf("expected machine to stay allocated")
+				}
+			},
+		},
+		{
+			name: "free unhealthy machine that was already recovered",
+			api: fake.NewMetalAPI(func() *models.V1MachineResponse {
+				m := allocatedMachine("m1")
+				m.Tags = append(m.Tags, tag.New(machineRecoveredTagKey, "reset"))
+				return m
+			}()),
+			providerID: "metal:///a-partition/m1",
+			opts:       Options{RecoveryAction: RecoveryActionReset},
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}},
+			want: &driver.DeleteMachineResponse{
+				LastKnownState: `{"state":"Freed","id":"m1","partition":"a-partition"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: tt.api}, Options: tt.opts}
+
+			machine := testMachine(tt.providerID)
+			machine.Status.Conditions = tt.conditions
+
+			got, err := p.DeleteMachine(context.Background(), &driver.DeleteMachineRequest{
+				Machine:      machine,
+				MachineClass: testMachineClass(t, nil),
+				Secret:       testSecret(),
+			})
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+
+			if tt.check != nil {
+				tt.check(t, tt.api)
+			}
+		})
+	}
+}
+
+func TestProvider_UnknownFields(t *testing.T) {
+	class := testMachineClass(t, nil)
+	class.ProviderSpec.Raw = append([]byte(`{"sshKey":["a-key"],`), class.ProviderSpec.Raw[1:]...)
+	unknownFieldErr := status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: unknown field "providerSpec.sshKey"`)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		call    func(p *Provider) error
+		wantErr error
+	}{
+		{
+			name: "creation is rejected",
+			call: func(p *Provider) error {
+				_, err := p.CreateMachine(context.Background(), &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: class, Secret: testSecret()})
+				return err
+			},
+			wantErr: unknownFieldErr,
+		},
+		{
+			name: "initialization is rejected",
+			call: func(p *Provider) error {
+				_, err := p.InitializeMachine(context.Background(), &driver.InitializeMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: class, Secret: testSecret()})
+				return err
+			},
+			wantErr: unknownFieldErr,
+		},
+		{
+			name: "creation only warns if enabled",
+			opts: Options{WarnUnknownFields: true},
+			call: func(p *Provider) error {
+				_, err := p.CreateMachine(context.Background(), &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: class, Secret: testSecret()})
+				return err
+			},
+		},
+		{
+			name: "deletion only warns",
+			call: func(p *Provider) error {
+				_, err := p.DeleteMachine(context.Background(), &driver.DeleteMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: class, Secret: testSecret()})
+				return err
+			},
+		},
+		{
+			name: "listing only warns",
+			call: func(p *Provider) error {
+				_, err := p.ListMachines(context.Background(), &driver.ListMachinesRequest{MachineClass: class, Secret: testSecret()})
+				return err
+			},
+		},
+		{
+			name: "status only warns",
+			call: func(p *Provider) error {
+				_, err := p.GetMachineStatus(context.Background(), &driver.GetMachineStatusRequest{Machine: testMachine("metal:///a-partition/m2"), MachineClass: class, Secret: testSecret()})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{
+				SPI:     &fake.SPI{MetalAPI: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize), allocatedMachine("m2", "Phoned Home")).WithImages(testImages()...)},
+				Options: tt.opts,
+			}
+
+			err := tt.call(p)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+		})
+	}
+}
+
+func TestProvider_RequestContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		opts    Options
+		call    func(ctx context.Context, p *Provider) error
+		wantErr error
+	}{
+		{
+			name: "canceled creation",
+			ctx:  canceled,
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.Canceled, "context canceled"),
+		},
+		{
+			name: "creation exceeds the deadline of the request",
+			ctx:  expired,
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+		},
+		{
+			name: "deletion exceeds the timeout of the operation",
+			ctx:  context.Background(),
+			opts: Options{Timeouts: Timeouts{Delete: time.Nanosecond}},
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.DeleteMachine(ctx, &driver.DeleteMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+		},
+		{
+			name: "canceled status request",
+			ctx:  canceled,
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.GetMachineStatus(ctx, &driver.GetMachineStatusRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.Canceled, "context canceled"),
+		},
+		{
+			name: "canceled listing",
+			ctx:  canceled,
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.ListMachines(ctx, &driver.ListMachinesRequest{MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.Canceled, "context canceled"),
+		},
+		{
+			name: "canceled initialization",
+			ctx:  canceled,
+			call: func(ctx context.Context, p *Provider) error {
+				_, err := p.InitializeMachine(ctx, &driver.InitializeMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: testMachineClass(t, nil), Secret: testSecret()})
+				return err
+			},
+			wantErr: status.Error(codes.Canceled, "context canceled"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: fake.NewMetalAPI(allocatedMachine("m1", "Phoned Home"))}, Options: tt.opts}
+
+			err := tt.call(tt.ctx, p)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+		})
+	}
+}
+
+func TestProvider_GetMachineStatus(t *testing.T) {
+	otherCluster := allocatedMachine("m1", "Phoned Home")
+	otherCluster.Tags = []string{tag.New(tag.ClusterID, "another-cluster")}
+
+	crashLoopMachine := allocatedMachine("m1", "Installing", "PXE Booting")
+	crashLoopMachine.Events.CrashLoop = pointer.Pointer(true)
+
+	tests := []struct {
+		name       string
+		api        *fake.MetalAPI
+		providerID string
+		want       *driver.GetMachineStatusResponse
+		wantErr    error
+	}{
+		{
+			name:       "provisioned machine",
+			api:        fake.NewMetalAPI(allocatedMachine("m1", "Phoned Home", "Booting New Kernel")),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.GetMachineStatusResponse{
+				ProviderID: "metal:///a-partition/m1",
+				NodeName:   "a-machine",
+			},
+		},
+		{
+			name:       "machine in provisioning",
+			api:        fake.NewMetalAPI(allocatedMachine("m1", "Installing", "Waiting", "PXE Booting")),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.GetMachineStatusResponse{
+				ProviderID: "metal:///a-partition/m1",
+				NodeName:   "a-machine",
+			},
+			wantErr: status.Error(codes.Uninitialized, `machine has not phoned home yet, last provisioning event is "Installing", provisioning progress: PXE Booting -> Waiting -> Installing`),
+		},
+		{
+			name:       "machine without provisioning events",
+			api:        fake.NewMetalAPI(allocatedMachine("m1")),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.GetMachineStatusResponse{
+				ProviderID: "metal:///a-partition/m1",
+				NodeName:   "a-machine",
+			},
+			wantErr: status.Error(codes.Uninitialized, "machine has not sent any provisioning events yet"),
+		},
+		{
+			name:       "machine in a provisioning crash loop",
+			api:        fake.NewMetalAPI(crashLoopMachine),
+			providerID: "metal:///a-partition/m1",
+			want: &driver.GetMachineStatusResponse{
+				ProviderID: "metal:///a-partition/m1",
+				NodeName:   "a-machine",
+			},
+			wantErr: status.Error(codes.Uninitialized, `machine is in a provisioning crash loop, provisioning progress: PXE Booting -> Installing`),
+		},
+		{
+			name:       "machine not yet created",
+			api:        fake.NewMetalAPI(),
+			providerID: "",
+			wantErr:    status.Error(codes.NotFound, "machine not found, not yet created"),
+		},
+		{
+			name:       "machine does not exist",
+			api:        fake.NewMetalAPI(),
+			providerID: "metal:///a-partition/m1",
+			wantErr:    status.Error(codes.NotFound, "machine m1 does not exist"),
+		},
+		{
+			name:       "machine released",
+			api:        fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			providerID: "metal:///a-partition/m1",
+			wantErr:    status.Error(codes.NotFound, "machine already released"),
+		},
+		{
+			name:       "machine of another cluster",
+			api:        fake.NewMetalAPI(otherCluster),
+			providerID: "metal:///a-partition/m1",
+			wantErr:    status.Error(codes.NotFound, "machine does not belong to this cluster anymore"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: tt.api}}
+
+			got, err := p.GetMachineStatus(context.Background(), &driver.GetMachineStatusRequest{
+				Machine:      testMachine(tt.providerID),
+				MachineClass: testMachineClass(t, nil),
+				Secret:       testSecret(),
+			})
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+			// the machine controller reads the provider id and node name of the response along with an uninitialized error
+			if s, _ := status.FromError(err); s.Code() == codes.Uninitialized && got == nil {
+				t.Errorf("expected a response along with the uninitialized error")
+			}
+		})
+	}
+}
+
+func TestProvider_InitializeMachine(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     *fake.MetalAPI
+		want    *driver.InitializeMachineResponse
+		wantErr error
+	}{
+		{
+			name: "provisioned machine",
+			api:  fake.NewMetalAPI(allocatedMachine("m1", "Phoned Home")),
+			want: &driver.InitializeMachineResponse{
+				ProviderID: "metal:///a-partition/m1",
+				NodeName:   "a-machine",
+			},
+		},
+		{
+			name:    "machine in provisioning",
+			api:     fake.NewMetalAPI(allocatedMachine("m1", "PXE Booting")),
+			wantErr: status.Error(codes.Uninitialized, `machine has not phoned home yet, last provisioning event is "PXE Booting"`),
+		},
+		{
+			name:    "machine released",
+			api:     fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)),
+			wantErr: status.Error(codes.NotFound, "machine already released"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: tt.api}}
+
+			got, err := p.InitializeMachine(context.Background(), &driver.InitializeMachineRequest{
+				Machine:      testMachine("metal:///a-partition/m1"),
+				MachineClass: testMachineClass(t, nil),
+				Secret:       testSecret(),
+			})
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func TestProvider_ListMachines(t *testing.T) {
+	otherCluster := allocatedMachine("m3")
+	otherCluster.Tags = []string{tag.New(tag.ClusterID, "another-cluster")}
+	recovered := releasedMachine("m2", "a-machine-class", RecoveryActionReset, time.Now())
+	recovered.Tags = []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineNameTagKey, "another-machine"), tag.New(machineRecoveredTagKey, "reset")}
+
+	tests := []struct {
+		name    string
+		api     *fake.MetalAPI
+		opts    Options
+		want    *driver.ListMachinesResponse
+		wantErr error
+	}{
+		{
+			name: "list machines of the cluster",
+			api:  fake.NewMetalAPI(allocatedMachine("m1"), allocatedMachine("m2"), otherCluster, fake.NewMachine("m4", testPartition, testSize)),
+			want: &driver.ListMachinesResponse{
+				MachineList: map[string]string{
+					"metal:///a-partition/m1": "a-machine",
+					"metal:///a-partition/m2": "a-machine",
+				},
+			},
+		},
+		{
+			name: "machines released for recovery are listed after the recovery timeout",
+			api: fake.NewMetalAPI(
+				releasedMachine("m1", "a-machine-class", RecoveryActionReset, time.Now()),
+				releasedMachine("m2", "a-machine-class", RecoveryActionReset, time.Now().Add(-time.Hour)),
+			),
+			opts: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.ListMachinesResponse{
+				MachineList: map[string]string{
+					"metal:///a-partition/m2": "an-unhealthy-machine",
+				},
+			},
+		},
+		{
+			name: "recovered machines are listed with the name of the adopting machine object",
+			api:  fake.NewMetalAPI(recovered),
+			opts: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: 10 * time.Minute},
+			want: &driver.ListMachinesResponse{
+				MachineList: map[string]string{
+					"metal:///a-partition/m2": "another-machine",
+				},
+			},
+		},
+		{
+			name:    "find fails",
+			api:     fake.NewMetalAPI().WithError("FindMachines", fake.HTTPError(http.StatusUnauthorized, "not authenticated")),
+			wantErr: status.Error(codes.Unauthenticated, "not authenticated"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{SPI: &fake.SPI{MetalAPI: tt.api}, Options: tt.opts}
+
+			got, err := p.ListMachines(context.Background(), &driver.ListMachinesRequest{
+				MachineClass: testMachineClass(t, nil),
+				Secret:       testSecret(),
+			})
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
@@ -1,40 +1,515 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"reflect"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis/install"
+	apiv1alpha1 "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis/v1alpha1"
 	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis/validation"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/client/partition"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/metal"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"github.com/metal-stack/metal-lib/pkg/tag"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	kjson "sigs.k8s.io/json"
 )
 
-// decodeProviderSpecAndSecret converts request parameters to api.ProviderSpec & api.Secrets
-func decodeProviderSpecAndSecret(machineClass *v1alpha1.MachineClass, secret *corev1.Secret) (*api.MetalProviderSpec, error) {
-	var (
-		providerSpec *api.MetalProviderSpec
-	)
+const (
+	// provisioningEventPhonedHome is the last provisioning event of a machine, it is sent once the installed operating system is up and running
+	provisioningEventPhonedHome = "Phoned Home"
+	// maxProvisioningProgress limits the amount of provisioning events that are reported to the machine object
+	maxProvisioningProgress = 10
+
+	// machineIdentityTagKey is the tag key used to identify the machine object a metal-stack machine was allocated for
+	machineIdentityTagKey = "machine.metal-stack.io/machine-controller-manager-uid"
+	// machineClassTagKey is the tag key used to record the machine class a machine was allocated for
+	machineClassTagKey = "machine.metal-stack.io/machine-class"
+	// machineFallbackTagKey is the tag key used to record the fallback partition and size a machine was allocated with
+	machineFallbackTagKey = "machine.metal-stack.io/allocation-fallback"
+	// machineRecoveryTagKey is the tag key used to mark a machine that was released for recovery with the recovery action
+	machineRecoveryTagKey = "machine.metal-stack.io/recovery"
+	// machineReleasedTagKey is the tag key used to record the time a machine was released for recovery
+	machineReleasedTagKey = "machine.metal-stack.io/recovery-released-at"
+	// machineRecoveredTagKey is the tag key used to record the recovery action a machine was recovered with
+	machineRecoveredTagKey = "machine.metal-stack.io/recovered"
+	// machinePowerOffTagKey is the tag key used to record the time a machine was powered off before it is freed
+	machinePowerOffTagKey = "machine.metal-stack.io/power-off-since"
+	// machineNameTagKey is the tag key used to record the name of the machine object that adopted a recovered machine,
+	// as the hostname of the machine is still the name of the machine object it was allocated for
+	machineNameTagKey = "machine.metal-stack.io/machine-name"
 
+	machineStateAllocated           = "Allocated"
+	machineStateFreed               = "Freed"
+	machineStateReleasedForRecovery = "ReleasedForRecovery"
+	machineStateRecovering          = "Recovering"
+	machineStatePoweringOff         = "PoweringOff"
+)
+
+// machineState is encoded into the LastKnownState of a machine object, such that operators can see
+// where a machine is stuck without looking up the machine at the metal-api
+type machineState struct {
+	State         string   `json:"state"`
+	ID            string   `json:"id,omitempty"`
+	Partition     string   `json:"partition,omitempty"`
+	Fallback      string   `json:"fallback,omitempty"`
+	Recovery      string   `json:"recovery,omitempty"`
+	LastEvent     string   `json:"lastEvent,omitempty"`
+	LastEventTime string   `json:"lastEventTime,omitempty"`
+	CrashLoop     bool     `json:"crashLoop,omitempty"`
+	Progress      []string `json:"progress,omitempty"`
+	PowerOffSince string   `json:"powerOffSince,omitempty"`
+}
+
+// providerSpecScheme knows all versions of the provider spec and how to convert them into the internal version
+var providerSpecScheme = runtime.NewScheme()
+
+func init() {
+	install.Install(providerSpecScheme)
+}
+
+// decodeProviderSpecAndSecret converts request parameters to api.ProviderSpec & api.Secrets.
+// Unknown and duplicate fields are rejected if strict is set, otherwise they are only logged as warning.
+// Keys of v1alpha1 provider specs that only differ in case from a field are never rejected but logged as warning.
+func decodeProviderSpecAndSecret(ctx context.Context, machineClass *v1alpha1.MachineClass, secret *corev1.Secret, opts Options, strict bool) (*api.MetalProviderSpec, error) {
 	// Extract providerSpec
-	err := json.Unmarshal(machineClass.ProviderSpec.Raw, &providerSpec)
+	providerSpec, strictErrs, err := decodeProviderSpec(machineClass.ProviderSpec.Raw)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+	var rejected []error
+	for _, err := range strictErrs {
+		var caseErr *caseMismatchError
+		if !errors.As(err, &caseErr) {
+			rejected = append(rejected, err)
+		}
 	}
+	if strict && len(rejected) > 0 {
+		return nil, decodeError(rejected...)
+	}
+	if len(strictErrs) > 0 {
+		klog.FromContext(ctx).Info("ignoring field errors of the provider spec", "errors", errorMessages(strictErrs))
+	}
+
+	defaultProviderSpec(providerSpec, opts)
 
 	//Validate the Spec and Secrets
-	ValidationErr := validation.ValidateMetalProviderSpec(providerSpec, secret)
-	if ValidationErr != nil {
-		err = fmt.Errorf("error while validating ProviderSpec %v", ValidationErr)
-		return nil, status.Error(codes.Internal, err.Error())
+	if errs := validation.ValidateMetalProviderSpec(providerSpec, secret); len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("error while validating ProviderSpec: %s", strings.Join(msgs, ", ")))
 	}
 
 	return providerSpec, nil
 }
 
+// decodeProviderSpec decodes any version of the provider spec into the internal version, defaults are applied by the version given in apiVersion.
+// A provider spec without apiVersion is decoded as v1alpha1 to stay compatible with existing machine classes.
+// Unknown and duplicate fields do not fail the decoding but are returned as strict errors, the caller decides whether to reject them.
+// v1alpha1 provider specs are decoded case-insensitively like before their versioning, keys that only differ in case
+// from a field are returned as caseMismatchError.
+func decodeProviderSpec(raw []byte) (*api.MetalProviderSpec, []error, error) {
+	var (
+		typeMeta metav1.TypeMeta
+		specPath = field.NewPath("providerSpec")
+		gvk      = apiv1alpha1.SchemeGroupVersion.WithKind(api.Kind)
+	)
+
+	err := json.Unmarshal(raw, &typeMeta)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if typeMeta.APIVersion != "" {
+		gvk = schema.FromAPIVersionAndKind(typeMeta.APIVersion, api.Kind)
+	}
+	if typeMeta.Kind != "" && typeMeta.Kind != api.Kind {
+		return nil, nil, decodeError(field.NotSupported(specPath.Child("kind"), typeMeta.Kind, []string{api.Kind}))
+	}
+
+	versioned, err := providerSpecScheme.New(gvk)
+	if err != nil {
+		var supported []string
+		for _, gv := range providerSpecScheme.PrioritizedVersionsForGroup(api.GroupName) {
+			supported = append(supported, gv.String())
+		}
+		return nil, nil, decodeError(field.NotSupported(specPath.Child("apiVersion"), typeMeta.APIVersion, supported))
+	}
+
+	// unknown fields are reported as typos would otherwise silently be ignored
+	strictErrs, err := kjson.UnmarshalStrict(raw, versioned)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if gvk.Version == apiv1alpha1.SchemeGroupVersion.Version {
+		err = json.Unmarshal(raw, versioned)
+		if err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		strictErrs = caseMismatches(reflect.TypeOf(versioned), strictErrs)
+	}
+
+	for _, err := range strictErrs {
+		var fieldErr kjson.FieldError
+		if errors.As(err, &fieldErr) {
+			fieldErr.SetFieldPath(specPath.String() + "." + fieldErr.FieldPath())
+		}
+	}
+
+	providerSpecScheme.Default(versioned)
+
+	providerSpec := &api.MetalProviderSpec{}
+	err = providerSpecScheme.Convert(versioned, providerSpec, nil)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("error while converting ProviderSpec: %v", err))
+	}
+
+	return providerSpec, strictErrs, nil
+}
+
+// caseMismatchError is a key of a provider spec that only matches a field case-insensitively
+type caseMismatchError struct {
+	path  string
+	field string
+}
+
+func (e *caseMismatchError) Error() string {
+	return fmt.Sprintf("field %q only matches %q case-insensitively", e.path, e.field)
+}
+
+// FieldPath implements kjson.FieldError
+func (e *caseMismatchError) FieldPath() string {
+	return e.path
+}
+
+// SetFieldPath implements kjson.FieldError
+func (e *caseMismatchError) SetFieldPath(path string) {
+	e.path = path
+}
+
+// caseMismatches replaces the unknown field errors of keys that match a field of the given type case-insensitively by a caseMismatchError
+func caseMismatches(t reflect.Type, strictErrs []error) []error {
+	var errs []error
+	for _, err := range strictErrs {
+		var fieldErr kjson.FieldError
+		if errors.As(err, &fieldErr) && strings.HasPrefix(err.Error(), "unknown field") {
+			if name, ok := foldedFieldName(t, fieldErr.FieldPath()); ok {
+				errs = append(errs, &caseMismatchError{path: fieldErr.FieldPath(), field: name})
+				continue
+			}
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// foldedFieldName returns the json name of the field at the given path of the given type,
+// the last element of the path is matched case-insensitively
+func foldedFieldName(t reflect.Type, path string) (string, bool) {
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		segment, _, _ = strings.Cut(segment, "[")
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return "", false
+		}
+
+		last := i == len(segments)-1
+		f, name, ok := jsonField(t, segment, last)
+		if !ok {
+			return "", false
+		}
+		if last {
+			return name, true
+		}
+		t = f.Type
+	}
+	return "", false
+}
+
+// jsonField returns the field of the given struct type with the given json name including inlined structs
+func jsonField(t reflect.Type, name string, fold bool) (reflect.StructField, string, bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tagName, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && tagName == "" && f.Type.Kind() == reflect.Struct {
+			if inlined, inlinedName, ok := jsonField(f.Type, name, fold); ok {
+				return inlined, inlinedName, true
+			}
+			continue
+		}
+		if tagName == "" {
+			tagName = f.Name
+		}
+		if tagName == name || (fold && strings.EqualFold(tagName, name)) {
+			return f, tagName, true
+		}
+	}
+	return reflect.StructField{}, "", false
+}
+
+func decodeError(errs ...error) error {
+	return status.Error(codes.InvalidArgument, fmt.Sprintf("error while decoding ProviderSpec: %s", strings.Join(errorMessages(errs), ", ")))
+}
+
+func errorMessages(errs []error) []string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// defaultProviderSpec fills the fields which are not set in the provider spec with the defaults given by the controller flags
+func defaultProviderSpec(spec *api.MetalProviderSpec, opts Options) {
+	if spec.Image == "" {
+		spec.Image = opts.DefaultImage
+	}
+	if spec.Network == "" && len(spec.Networks) == 0 && opts.DefaultNetwork != "" {
+		spec.Networks = []api.Network{{ID: opts.DefaultNetwork, Autoacquire: pointer.Pointer(true)}}
+	}
+	if len(spec.SSHKeys) == 0 {
+		spec.SSHKeys = slices.Clone(opts.DefaultSSHKeys)
+	}
+	if len(spec.DNSServers) == 0 {
+		for _, ip := range opts.DefaultDNSServers {
+			spec.DNSServers = append(spec.DNSServers, api.DNSServer{IP: ip})
+		}
+	}
+	if len(spec.NTPServers) == 0 {
+		for _, address := range opts.DefaultNTPServers {
+			spec.NTPServers = append(spec.NTPServers, api.NTPServer{Address: address})
+		}
+	}
+}
+
+// partitionServers returns the dns and ntp servers of the provider spec, the ones which are neither set in the provider spec
+// nor by the controller flags are filled with the ones of the given partition. The servers of the partition are validated
+// the same way as the ones of the provider spec.
+func partitionServers(ctx context.Context, m metalgo.Client, spec *api.MetalProviderSpec, partitionID string) ([]api.DNSServer, []api.NTPServer, error) {
+	resp, err := m.Partition().FindPartition(partition.NewFindPartitionParamsWithContext(ctx).WithID(partitionID), nil)
+	if err != nil {
+		return nil, nil, metalErrorToStatus(err)
+	}
+
+	var (
+		dnsServers        = spec.DNSServers
+		ntpServers        = spec.NTPServers
+		defaultDNSServers []api.DNSServer
+		defaultNTPServers []api.NTPServer
+	)
+	if len(dnsServers) == 0 {
+		for _, s := range resp.Payload.DNSServers {
+			defaultDNSServers = append(defaultDNSServers, api.DNSServer{IP: pointer.SafeDeref(s.IP)})
+		}
+		dnsServers = defaultDNSServers
+	}
+	if len(ntpServers) == 0 {
+		for _, s := range resp.Payload.NtpServers {
+			defaultNTPServers = append(defaultNTPServers, api.NTPServer{Address: pointer.SafeDeref(s.Address)})
+		}
+		ntpServers = defaultNTPServers
+	}
+
+	if errs := validation.ValidatePartitionServers(partitionID, defaultDNSServers, defaultNTPServers); len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, nil, status.Error(codes.InvalidArgument, fmt.Sprintf("error while validating the defaults of partition %q: %s", partitionID, strings.Join(msgs, ", ")))
+	}
+
+	return dnsServers, ntpServers, nil
+}
+
+// allocationServers returns the dns and ntp servers a machine is allocated with
+func allocationServers(dnsServers []api.DNSServer, ntpServers []api.NTPServer) ([]*models.V1DNSServer, []*models.V1NTPServer) {
+	var dns []*models.V1DNSServer
+	for _, s := range dnsServers {
+		dns = append(dns, &models.V1DNSServer{
+			IP: pointer.Pointer(s.IP),
+		})
+	}
+
+	var ntp []*models.V1NTPServer
+	for _, s := range ntpServers {
+		ntp = append(ntp, &models.V1NTPServer{
+			Address: pointer.Pointer(s.Address),
+		})
+	}
+
+	return dns, ntp
+}
+
+// placement is a partition and size a machine can be allocated in
+type placement struct {
+	partition string
+	size      string
+}
+
+func (p placement) String() string {
+	return p.partition + "/" + p.size
+}
+
+// allocationPlacements returns the partitions and sizes a machine is allocated in, in the order they are tried.
+// All sizes are tried in a partition before the next partition is tried.
+func allocationPlacements(spec *api.MetalProviderSpec) []placement {
+	var placements []placement
+	for _, partition := range append([]string{spec.Partition}, spec.FallbackPartitions...) {
+		for _, size := range append([]string{spec.Size}, spec.FallbackSizes...) {
+			placements = append(placements, placement{partition: partition, size: size})
+		}
+	}
+	return placements
+}
+
+// partitionNetworks returns the networks of the given partition, which are the fallback networks for fallback partitions
+func partitionNetworks(spec *api.MetalProviderSpec, partition string) []api.Network {
+	if partition == spec.Partition {
+		return spec.Networks
+	}
+	for _, pn := range spec.FallbackNetworks {
+		if pn.Partition == partition {
+			return pn.Networks
+		}
+	}
+	return nil
+}
+
+// allocationNetworks returns the networks and static ip addresses a machine is allocated with in the given partition
+func allocationNetworks(spec *api.MetalProviderSpec, partition string) ([]*models.V1MachineAllocationNetwork, []string) {
+	if spec.Network != "" && partition == spec.Partition {
+		return []*models.V1MachineAllocationNetwork{
+			{
+				Autoacquire: pointer.Pointer(true),
+				Networkid:   pointer.Pointer(spec.Network),
+			},
+		}, nil
+	}
+
+	var (
+		networks []*models.V1MachineAllocationNetwork
+		ips      []string
+	)
+	for _, n := range partitionNetworks(spec, partition) {
+		networks = append(networks, &models.V1MachineAllocationNetwork{
+			Autoacquire: pointer.Pointer(n.AutoacquireEnabled()),
+			Networkid:   pointer.Pointer(n.ID),
+		})
+		ips = append(ips, n.IPs...)
+	}
+
+	return networks, ips
+}
+
+// filesystemLayoutMatches returns true if the constraints of the filesystem layout allow the given size and image
+func filesystemLayoutMatches(fsl *models.V1FilesystemLayoutResponse, size, image string) bool {
+	if fsl.Constraints == nil {
+		return false
+	}
+
+	sizeMatches := false
+	for _, s := range fsl.Constraints.Sizes {
+		if matched, _ := path.Match(s, size); matched {
+			sizeMatches = true
+			break
+		}
+	}
+	if !sizeMatches {
+		return false
+	}
+
+	os, version, err := metal.GetOsAndSemverFromImage(image)
+	if err != nil {
+		return false
+	}
+
+	for imageOS, versionConstraint := range fsl.Constraints.Images {
+		if imageOS != os {
+			continue
+		}
+
+		c, err := semver.NewConstraint(versionConstraint)
+		if err != nil {
+			continue
+		}
+
+		if c.Check(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// machineIdentityTag returns a deterministic tag for the given machine object, which is attached
+// to the allocated machine in order to prevent double allocations for the same machine object
+func machineIdentityTag(m *v1alpha1.Machine) string {
+	id := string(m.UID)
+	if id == "" {
+		id = m.Name
+	}
+	return tag.New(machineIdentityTagKey, id)
+}
+
+// machineClassTag returns the tag of the given machine class, which is attached to the allocated machine
+// in order to identify the worker pool it belongs to
+func machineClassTag(mc *v1alpha1.MachineClass) string {
+	return tag.New(machineClassTagKey, mc.Name)
+}
+
+// findAllocatedMachine returns the machine that was already allocated with the given machine identity tag
+// or nil if there is no such machine
+func findAllocatedMachine(ctx context.Context, m metalgo.Client, project, clusterIDTag, machineTag string) (*models.V1MachineResponse, error) {
+	mfr := &models.V1MachineFindRequest{
+		AllocationProject: project,
+		Tags:              []string{tag.New(tag.ClusterID, clusterIDTag), machineTag},
+		AllocationRole:    models.V1MachineAllocationRoleMachine,
+	}
+
+	resp, err := m.Machine().FindMachines(machine.NewFindMachinesParamsWithContext(ctx).WithBody(mfr), nil)
+	if err != nil {
+		return nil, metalErrorToStatus(err)
+	}
+
+	switch len(resp.Payload) {
+	case 0:
+		return nil, nil
+	case 1:
+		existing := resp.Payload[0]
+		if existing.ID == nil || existing.Allocation == nil || existing.Allocation.Name == nil || existing.Partition == nil || existing.Partition.ID == nil {
+			return nil, status.Error(codes.Internal, "machine response contains invalid fields")
+		}
+		return existing, nil
+	default:
+		return nil, status.Error(codes.Internal, fmt.Sprintf("found more than one machine allocated with tag %q", machineTag))
+	}
+}
+
 func encodeMachineID(partition, machineID string) string {
 	return fmt.Sprintf("metal:///%s/%s", partition, machineID)
 }
@@ -43,3 +518,93 @@ func decodeMachineID(id string) string {
 	splitProviderID := strings.Split(id, "/")
 	return splitProviderID[len(splitProviderID)-1]
 }
+
+// checkProvisioningEvents inspects the provisioning event log of a machine and returns a status error as long as
+// the machine has not finished provisioning. A crash loop or a failed machine reclaim is reported as a hard failure.
+func checkProvisioningEvents(events *models.V1MachineRecentProvisioningEvents) error {
+	if events == nil || len(events.Log) == 0 {
+		return status.Error(codes.Uninitialized, "machine has not sent any provisioning events yet")
+	}
+
+	if pointer.SafeDeref(events.FailedMachineReclaim) {
+		return status.Error(codes.Internal, "machine reclaim has failed")
+	}
+
+	if pointer.SafeDeref(events.CrashLoop) {
+		msg := "machine is in a provisioning crash loop"
+		if events.LastErrorEvent != nil {
+			msg = fmt.Sprintf("%s, last error event: %s %s", msg, pointer.SafeDeref(events.LastErrorEvent.Event), events.LastErrorEvent.Message)
+		}
+		return status.Error(codes.Internal, msg)
+	}
+
+	// the log is ordered from the most recent to the oldest event
+	last := pointer.SafeDeref(events.Log[0].Event)
+	if last != provisioningEventPhonedHome {
+		return status.Error(codes.Uninitialized, fmt.Sprintf("machine has not phoned home yet, last provisioning event is %q", last))
+	}
+
+	return nil
+}
+
+// provisioningProgress returns the most recent provisioning events of a machine in chronological order
+func provisioningProgress(events *models.V1MachineRecentProvisioningEvents) []string {
+	if events == nil {
+		return nil
+	}
+
+	var progress []string
+	for i := min(len(events.Log), maxProvisioningProgress) - 1; i >= 0; i-- {
+		progress = append(progress, pointer.SafeDeref(events.Log[i].Event))
+	}
+
+	return progress
+}
+
+// encodeMachineState returns the last known state of a machine for the given state
+func encodeMachineState(state string, m *models.V1MachineResponse) string {
+	return newMachineState(state, m).encode()
+}
+
+func newMachineState(state string, m *models.V1MachineResponse) *machineState {
+	ms := &machineState{
+		State: state,
+		ID:    pointer.SafeDeref(m.ID),
+	}
+
+	if m.Partition != nil {
+		ms.Partition = pointer.SafeDeref(m.Partition.ID)
+	}
+
+	if fallback, ok := tag.NewTagMap(m.Tags).Value(machineFallbackTagKey); ok {
+		ms.Fallback = fallback
+	}
+
+	if recovery, ok := tag.NewTagMap(m.Tags).Value(machineRecoveryTagKey); ok {
+		ms.Recovery = recovery
+	} else if recovered, ok := tag.NewTagMap(m.Tags).Value(machineRecoveredTagKey); ok {
+		ms.Recovery = recovered
+	}
+
+	if m.Events != nil {
+		ms.CrashLoop = pointer.SafeDeref(m.Events.CrashLoop)
+		ms.Progress = provisioningProgress(m.Events)
+		if len(m.Events.Log) > 0 {
+			ms.LastEvent = pointer.SafeDeref(m.Events.Log[0].Event)
+		}
+		if !time.Time(m.Events.LastEventTime).IsZero() {
+			ms.LastEventTime = m.Events.LastEventTime.String()
+		}
+	}
+
+	return ms
+}
+
+func (ms *machineState) encode() string {
+	raw, err := json.Marshal(ms)
+	if err != nil {
+		return ms.State
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,461 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/google/go-cmp/cmp"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_decodeProviderSpecAndSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		lenient bool
+		want    *api.MetalProviderSpec
+		wantErr error
+	}{
+		{
+			name: "spec without type meta",
+			raw:  `{"partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","network":"a-network","sshKeys":["a-key"]}`,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Network:   "a-network",
+				SSHKeys:   []string{"a-key"},
+			},
+		},
+		{
+			name: "v1alpha1 spec",
+			raw:  `{"apiVersion":"machine.metal-stack.io/v1alpha1","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network"},{"id":"internet","autoacquire":false,"ips":["212.34.83.10"]}]}`,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Networks: []api.Network{
+					{ID: "a-network", Autoacquire: pointer.Pointer(true)},
+					{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}},
+				},
+			},
+		},
+		{
+			name: "v1alpha2 spec",
+			raw:  `{"apiVersion":"machine.metal-stack.io/v1alpha2","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network"}],"sshKeys":["a-key"]}`,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Networks:  []api.Network{{ID: "a-network", Autoacquire: pointer.Pointer(true)}},
+				SSHKeys:   []string{"a-key"},
+			},
+		},
+		{
+			name: "autoacquire is disabled for networks with ips",
+			raw:  `{"apiVersion":"machine.metal-stack.io/v1alpha2","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network"},{"id":"internet","ips":["212.34.83.10"]}]}`,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Networks: []api.Network{
+					{ID: "a-network", Autoacquire: pointer.Pointer(true)},
+					{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}},
+				},
+			},
+		},
+		{
+			name:    "network field was removed in v1alpha2",
+			raw:     `{"apiVersion":"machine.metal-stack.io/v1alpha2","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","network":"a-network"}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: unknown field "providerSpec.network"`),
+		},
+		{
+			name:    "unknown fields",
+			raw:     `{"partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network","autoacquired":true}],"sshKey":["a-key"]}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: unknown field "providerSpec.networks[0].autoacquired", unknown field "providerSpec.sshKey"`),
+		},
+		{
+			name:    "unknown fields are ignored if not strict",
+			raw:     `{"partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network","autoacquired":true}],"sshKey":["a-key"]}`,
+			lenient: true,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Networks:  []api.Network{{ID: "a-network", Autoacquire: pointer.Pointer(true)}},
+			},
+		},
+		{
+			name: "keys of v1alpha1 are matched case-insensitively",
+			raw:  `{"partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network","autoAcquire":false,"ips":["10.0.0.1"]}],"sshkeys":["a-key"]}`,
+			want: &api.MetalProviderSpec{
+				Partition: "a-partition",
+				Size:      "c1-xlarge-x86",
+				Image:     "ubuntu-24.4",
+				Project:   "a-project",
+				Networks:  []api.Network{{ID: "a-network", Autoacquire: pointer.Pointer(false), IPs: []string{"10.0.0.1"}}},
+				SSHKeys:   []string{"a-key"},
+			},
+		},
+		{
+			name:    "keys of v1alpha2 are matched case-sensitively",
+			raw:     `{"apiVersion":"machine.metal-stack.io/v1alpha2","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","networks":[{"id":"a-network"}],"sshkeys":["a-key"]}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: unknown field "providerSpec.sshkeys"`),
+		},
+		{
+			name:    "duplicate fields",
+			raw:     `{"partition":"a-partition","partition":"another-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","network":"a-network"}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: duplicate field "providerSpec.partition"`),
+		},
+		{
+			name:    "unsupported api version",
+			raw:     `{"apiVersion":"machine.metal-stack.io/v2","kind":"MetalProviderSpec","partition":"a-partition","size":"c1-xlarge-x86","image":"ubuntu-24.4","project":"a-project","network":"a-network"}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: providerSpec.apiVersion: Unsupported value: "machine.metal-stack.io/v2": supported values: "machine.metal-stack.io/v1alpha2", "machine.metal-stack.io/v1alpha1"`),
+		},
+		{
+			name:    "unsupported kind",
+			raw:     `{"apiVersion":"machine.metal-stack.io/v1alpha2","kind":"MachineClass"}`,
+			wantErr: status.Error(codes.InvalidArgument, `error while decoding ProviderSpec: providerSpec.kind: Unsupported value: "MachineClass": supported values: "MetalProviderSpec"`),
+		},
+		{
+			name:    "malformed json",
+			raw:     `{"partition":`,
+			wantErr: status.Error(codes.InvalidArgument, "unexpected end of JSON input"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineClass := &v1alpha1.MachineClass{
+				ObjectMeta:   metav1.ObjectMeta{Name: "a-machine-class"},
+				ProviderSpec: runtime.RawExtension{Raw: []byte(tt.raw)},
+			}
+
+			got, err := decodeProviderSpecAndSecret(context.Background(), machineClass, testSecret(), Options{}, !tt.lenient)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_defaultProviderSpec(t *testing.T) {
+	opts := Options{
+		DefaultImage:      "ubuntu-24.4",
+		DefaultNetwork:    "a-network",
+		DefaultSSHKeys:    []string{"a-key"},
+		DefaultDNSServers: []string{"1.1.1.1"},
+		DefaultNTPServers: []string{"0.de.pool.ntp.org", "1.de.pool.ntp.org", "2.de.pool.ntp.org"},
+	}
+
+	tests := []struct {
+		name string
+		spec *api.MetalProviderSpec
+		opts Options
+		want *api.MetalProviderSpec
+	}{
+		{
+			name: "no defaults",
+			spec: &api.MetalProviderSpec{Partition: "a-partition"},
+			want: &api.MetalProviderSpec{Partition: "a-partition"},
+		},
+		{
+			name: "empty spec is defaulted",
+			spec: &api.MetalProviderSpec{Partition: "a-partition"},
+			opts: opts,
+			want: &api.MetalProviderSpec{
+				Partition:  "a-partition",
+				Image:      "ubuntu-24.4",
+				Networks:   []api.Network{{ID: "a-network", Autoacquire: pointer.Pointer(true)}},
+				SSHKeys:    []string{"a-key"},
+				DNSServers: []api.DNSServer{{IP: "1.1.1.1"}},
+				NTPServers: []api.NTPServer{{Address: "0.de.pool.ntp.org"}, {Address: "1.de.pool.ntp.org"}, {Address: "2.de.pool.ntp.org"}},
+			},
+		},
+		{
+			name: "spec takes precedence",
+			spec: &api.MetalProviderSpec{
+				Image:      "debian-12",
+				Network:    "another-network",
+				SSHKeys:    []string{"another-key"},
+				DNSServers: []api.DNSServer{{IP: "8.8.8.8"}},
+				NTPServers: []api.NTPServer{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}, {Address: "10.0.0.3"}},
+			},
+			opts: opts,
+			want: &api.MetalProviderSpec{
+				Image:      "debian-12",
+				Network:    "another-network",
+				SSHKeys:    []string{"another-key"},
+				DNSServers: []api.DNSServer{{IP: "8.8.8.8"}},
+				NTPServers: []api.NTPServer{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}, {Address: "10.0.0.3"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultProviderSpec(tt.spec, tt.opts)
+
+			if diff := cmp.Diff(tt.want, tt.spec); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_allocationPlacements(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *api.MetalProviderSpec
+		want []placement
+	}{
+		{
+			name: "no fallbacks",
+			spec: &api.MetalProviderSpec{Partition: "a", Size: "s1"},
+			want: []placement{{partition: "a", size: "s1"}},
+		},
+		{
+			name: "sizes are tried before partitions",
+			spec: &api.MetalProviderSpec{Partition: "a", Size: "s1", FallbackSizes: []string{"s2"}, FallbackPartitions: []string{"b"}},
+			want: []placement{
+				{partition: "a", size: "s1"},
+				{partition: "a", size: "s2"},
+				{partition: "b", size: "s1"},
+				{partition: "b", size: "s2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocationPlacements(tt.spec)
+
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(placement{})); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_checkProvisioningEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  *models.V1MachineRecentProvisioningEvents
+		wantErr error
+	}{
+		{
+			name:    "no events",
+			events:  nil,
+			wantErr: status.Error(codes.Uninitialized, "machine has not sent any provisioning events yet"),
+		},
+		{
+			name: "still installing",
+			events: &models.V1MachineRecentProvisioningEvents{
+				Log: []*models.V1MachineProvisioningEvent{
+					{Event: pointer.Pointer("Installing")},
+					{Event: pointer.Pointer("Waiting")},
+					{Event: pointer.Pointer("PXE Booting")},
+				},
+			},
+			wantErr: status.Error(codes.Uninitialized, `machine has not phoned home yet, last provisioning event is "Installing"`),
+		},
+		{
+			name: "crash loop",
+			events: &models.V1MachineRecentProvisioningEvents{
+				CrashLoop: pointer.Pointer(true),
+				LastErrorEvent: &models.V1MachineProvisioningEvent{
+					Event:   pointer.Pointer("Crashed"),
+					Message: "kernel panic",
+				},
+				Log: []*models.V1MachineProvisioningEvent{
+					{Event: pointer.Pointer("PXE Booting")},
+				},
+			},
+			wantErr: status.Error(codes.Internal, "machine is in a provisioning crash loop, last error event: Crashed kernel panic"),
+		},
+		{
+			name: "failed reclaim",
+			events: &models.V1MachineRecentProvisioningEvents{
+				FailedMachineReclaim: pointer.Pointer(true),
+				Log: []*models.V1MachineProvisioningEvent{
+					{Event: pointer.Pointer("Phoned Home")},
+				},
+			},
+			wantErr: status.Error(codes.Internal, "machine reclaim has failed"),
+		},
+		{
+			name: "phoned home",
+			events: &models.V1MachineRecentProvisioningEvents{
+				Log: []*models.V1MachineProvisioningEvent{
+					{Event: pointer.Pointer("Phoned Home")},
+					{Event: pointer.Pointer("Booting New Kernel")},
+				},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProvisioningEvents(tt.events)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_encodeMachineState(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		machine *models.V1MachineResponse
+		want    string
+	}{
+		{
+			name:  "allocated machine without events",
+			state: machineStateAllocated,
+			machine: &models.V1MachineResponse{
+				ID:        pointer.Pointer("a-machine"),
+				Partition: &models.V1PartitionResponse{ID: pointer.Pointer("a-partition")},
+			},
+			want: `{"state":"Allocated","id":"a-machine","partition":"a-partition"}`,
+		},
+		{
+			name:  "machine in provisioning",
+			state: machineStateAllocated,
+			machine: &models.V1MachineResponse{
+				ID: pointer.Pointer("a-machine"),
+				Events: &models.V1MachineRecentProvisioningEvents{
+					CrashLoop: pointer.Pointer(true),
+					Log: []*models.V1MachineProvisioningEvent{
+						{Event: pointer.Pointer("Installing")},
+						{Event: pointer.Pointer("Waiting")},
+						{Event: pointer.Pointer("PXE Booting")},
+					},
+				},
+			},
+			want: `{"state":"Allocated","id":"a-machine","lastEvent":"Installing","crashLoop":true,"progress":["PXE Booting","Waiting","Installing"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeMachineState(tt.state, tt.machine)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_allocationNetworks(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         *api.MetalProviderSpec
+		partition    string
+		wantNetworks []*models.V1MachineAllocationNetwork
+		wantIPs      []string
+	}{
+		{
+			name: "single network",
+			spec: &api.MetalProviderSpec{
+				Partition: "a",
+				Network:   "private",
+			},
+			partition: "a",
+			wantNetworks: []*models.V1MachineAllocationNetwork{
+				{Networkid: pointer.Pointer("private"), Autoacquire: pointer.Pointer(true)},
+			},
+		},
+		{
+			name: "multiple networks with static ips",
+			spec: &api.MetalProviderSpec{
+				Partition: "a",
+				Networks: []api.Network{
+					{ID: "private"},
+					{ID: "storage", Autoacquire: pointer.Pointer(true)},
+					{ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.10"}},
+				},
+			},
+			partition: "a",
+			wantNetworks: []*models.V1MachineAllocationNetwork{
+				{Networkid: pointer.Pointer("private"), Autoacquire: pointer.Pointer(true)},
+				{Networkid: pointer.Pointer("storage"), Autoacquire: pointer.Pointer(true)},
+				{Networkid: pointer.Pointer("internet"), Autoacquire: pointer.Pointer(false)},
+			},
+			wantIPs: []string{"212.34.83.10"},
+		},
+		{
+			name: "networks of a fallback partition",
+			spec: &api.MetalProviderSpec{
+				Partition: "a",
+				Network:   "private-a",
+				FallbackNetworks: []api.PartitionNetworks{
+					{Partition: "b", Networks: []api.Network{{ID: "private-b"}, {ID: "internet", Autoacquire: pointer.Pointer(false), IPs: []string{"212.34.83.11"}}}},
+				},
+			},
+			partition: "b",
+			wantNetworks: []*models.V1MachineAllocationNetwork{
+				{Networkid: pointer.Pointer("private-b"), Autoacquire: pointer.Pointer(true)},
+				{Networkid: pointer.Pointer("internet"), Autoacquire: pointer.Pointer(false)},
+			},
+			wantIPs: []string{"212.34.83.11"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, ips := allocationNetworks(tt.spec, tt.partition)
+
+			if diff := cmp.Diff(tt.wantNetworks, networks); diff != "" {
+				t.Errorf("networks diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantIPs, ips); diff != "" {
+				t.Errorf("ips diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_filesystemLayoutMatches(t *testing.T) {
+	fsl := &models.V1FilesystemLayoutResponse{
+		ID: pointer.Pointer("c1-large"),
+		Constraints: &models.V1FilesystemLayoutConstraints{
+			Sizes:  []string{"c1-large-x86", "s2-*"},
+			Images: map[string]string{"ubuntu": ">= 22.4", "debian": "*"},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		size  string
+		image string
+		want  bool
+	}{
+		{name: "matching size and image", size: "c1-large-x86", image: "ubuntu-24.4", want: true},
+		{name: "wildcard size", size: "s2-xlarge-x86", image: "debian-12", want: true},
+		{name: "image version too old", size: "c1-large-x86", image: "ubuntu-20.4", want: false},
+		{name: "unknown os", size: "c1-large-x86", image: "firewall-ubuntu-3.0", want: false},
+		{name: "unknown size", size: "c2-large-x86", image: "ubuntu-24.4", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filesystemLayoutMatches(fsl, tt.size, tt.image); got != tt.want {
+				t.Errorf("filesystemLayoutMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
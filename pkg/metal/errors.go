@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/go-openapi/runtime"
+	"github.com/metal-stack/metal-lib/httperrors"
+)
+
+// noCapacityMessages are fragments of metal-api error messages indicating that no machine can be allocated
+var noCapacityMessages = []string{
+	"no machine available",
+	"no machine candidate available",
+	"no free machine",
+	// returned for a pinned machine which is allocated already or not ready for allocation
+	"is not available",
+}
+
+// metalErrorToStatus translates an error returned by metal-go into a status error
+// carrying the machine error code that corresponds to the cause of the error
+func metalErrorToStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var s *status.Status
+	if errors.As(err, &s) {
+		return s
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	var (
+		defaultResponse interface{ Code() int }
+		apiErr          *runtime.APIError
+		netErr          net.Error
+	)
+
+	switch {
+	case errors.As(err, &defaultResponse):
+		msg := err.Error()
+
+		var payloadResponse interface {
+			GetPayload() *httperrors.HTTPErrorResponse
+		}
+		if errors.As(err, &payloadResponse) && payloadResponse.GetPayload() != nil && payloadResponse.GetPayload().Message != "" {
+			msg = payloadResponse.GetPayload().Message
+		}
+
+		return status.Error(httpStatusToCode(defaultResponse.Code(), msg), msg)
+	case errors.As(err, &apiErr):
+		return status.Error(httpStatusToCode(apiErr.Code, err.Error()), err.Error())
+	case errors.As(err, &netErr):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// httpStatusToCode maps a http status code returned by the metal-api to a machine error code
+func httpStatusToCode(statusCode int, msg string) codes.Code {
+	for _, m := range noCapacityMessages {
+		if strings.Contains(strings.ToLower(msg), m) {
+			return codes.ResourceExhausted
+		}
+	}
+
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/go-openapi/runtime"
+	"github.com/google/go-cmp/cmp"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-lib/httperrors"
+)
+
+func Test_metalErrorToStatus(t *testing.T) {
+	defaultResponse := func(code int, msg string) error {
+		resp := machine.NewAllocateMachineDefault(code)
+		resp.Payload = &httperrors.HTTPErrorResponse{StatusCode: code, Message: msg}
+		return resp
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "no error",
+			err:     nil,
+			wantErr: nil,
+		},
+		{
+			name:    "status error is passed through",
+			err:     status.Error(codes.NotFound, "machine not found"),
+			wantErr: status.Error(codes.NotFound, "machine not found"),
+		},
+		{
+			name:    "no free machine",
+			err:     defaultResponse(http.StatusUnprocessableEntity, "no machine available"),
+			wantErr: status.Error(codes.ResourceExhausted, "no machine available"),
+		},
+		{
+			name:    "pinned machine not available",
+			err:     defaultResponse(http.StatusUnprocessableEntity, "machine 00000000-0000-0000-0000-000000000001 is not available"),
+			wantErr: status.Error(codes.ResourceExhausted, "machine 00000000-0000-0000-0000-000000000001 is not available"),
+		},
+		{
+			name:    "validation error",
+			err:     defaultResponse(http.StatusUnprocessableEntity, "size c1-xlarge does not exist"),
+			wantErr: status.Error(codes.InvalidArgument, "size c1-xlarge does not exist"),
+		},
+		{
+			name:    "bad request",
+			err:     defaultResponse(http.StatusBadRequest, "invalid request"),
+			wantErr: status.Error(codes.InvalidArgument, "invalid request"),
+		},
+		{
+			name:    "unauthenticated",
+			err:     defaultResponse(http.StatusUnauthorized, "invalid token"),
+			wantErr: status.Error(codes.Unauthenticated, "invalid token"),
+		},
+		{
+			name:    "forbidden",
+			err:     defaultResponse(http.StatusForbidden, "access denied"),
+			wantErr: status.Error(codes.PermissionDenied, "access denied"),
+		},
+		{
+			name:    "not found",
+			err:     defaultResponse(http.StatusNotFound, "machine does not exist"),
+			wantErr: status.Error(codes.NotFound, "machine does not exist"),
+		},
+		{
+			name:    "conflict",
+			err:     defaultResponse(http.StatusConflict, "machine is already allocated"),
+			wantErr: status.Error(codes.AlreadyExists, "machine is already allocated"),
+		},
+		{
+			name:    "service unavailable",
+			err:     defaultResponse(http.StatusServiceUnavailable, "rethinkdb unavailable"),
+			wantErr: status.Error(codes.Unavailable, "rethinkdb unavailable"),
+		},
+		{
+			name:    "internal server error",
+			err:     defaultResponse(http.StatusInternalServerError, "something went wrong"),
+			wantErr: status.Error(codes.Internal, "something went wrong"),
+		},
+		{
+			name:    "unexpected api error",
+			err:     &runtime.APIError{OperationName: "findMachine", Code: http.StatusBadGateway, Response: "bad gateway"},
+			wantErr: status.Error(codes.Unavailable, `findMachine (status 502): "bad gateway"`),
+		},
+		{
+			name:    "deadline exceeded",
+			err:     fmt.Errorf("request failed: %w", context.DeadlineExceeded),
+			wantErr: status.Error(codes.DeadlineExceeded, "request failed: context deadline exceeded"),
+		},
+		{
+			name:    "canceled",
+			err:     context.Canceled,
+			wantErr: status.Error(codes.Canceled, "context canceled"),
+		},
+		{
+			name:    "connection refused",
+			err:     &url.Error{Op: "Get", URL: "http://metal-api", Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}},
+			wantErr: status.Error(codes.Unavailable, `Get "http://metal-api": dial tcp: connection refused`),
+		},
+		{
+			name:    "unknown error",
+			err:     fmt.Errorf("unknown"),
+			wantErr: status.Error(codes.Internal, "unknown"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := metalErrorToStatus(tt.err)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+		})
+	}
+}
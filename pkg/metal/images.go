@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/image"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/metal"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+)
+
+const (
+	// imageClassificationDeprecated is the classification of images which must not be used for new machines anymore
+	imageClassificationDeprecated = "deprecated"
+	// imageClassificationPreview is the classification of images which are only used if they are given by their id
+	imageClassificationPreview = "preview"
+)
+
+// resolveImage resolves an image reference to the id of the latest usable image of the metal-api
+func resolveImage(ctx context.Context, m metalgo.Client, ref string) (string, error) {
+	resp, err := m.Image().ListImages(image.NewListImagesParamsWithContext(ctx), nil)
+	if err != nil {
+		return "", metalErrorToStatus(err)
+	}
+
+	return latestImage(resp.Payload, ref, time.Now())
+}
+
+// latestImage returns the id of the image matching the given reference which is neither deprecated nor expired.
+// If the reference is an image id, this image is returned. Otherwise the reference is treated as prefix of the
+// image version and the latest matching image is returned, e.g. ubuntu-24.04 resolves to ubuntu-24.4.20240315.
+// Preview images are only returned for their id, such that a version prefix never resolves to a preview.
+func latestImage(images []*models.V1ImageResponse, ref string, now time.Time) (string, error) {
+	for _, img := range images {
+		if pointer.SafeDeref(img.ID) != ref {
+			continue
+		}
+		if reason := imageUnusable(img, now); reason != "" {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("image %q is %s", ref, reason))
+		}
+		return ref, nil
+	}
+
+	os, prefix := parseImageReference(ref)
+
+	var (
+		latest   string
+		latestV  *semver.Version
+		unusable []string
+	)
+	for _, img := range images {
+		id := pointer.SafeDeref(img.ID)
+
+		imgOS, v, err := metal.GetOsAndSemverFromImage(id)
+		if err != nil || imgOS != os || !versionHasPrefix(v, prefix) {
+			continue
+		}
+
+		if reason := imageUnusable(img, now); reason != "" {
+			unusable = append(unusable, fmt.Sprintf("%s is %s", id, reason))
+			continue
+		}
+		if img.Classification == imageClassificationPreview {
+			unusable = append(unusable, fmt.Sprintf("%s is a preview, which has to be given by its id", id))
+			continue
+		}
+
+		if latestV == nil || v.GreaterThan(latestV) {
+			latest, latestV = id, v
+		}
+	}
+
+	switch {
+	case latest != "":
+		return latest, nil
+	case len(unusable) > 0:
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("no usable image found for %q: %s", ref, strings.Join(unusable, ", ")))
+	default:
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("no image found for %q", ref))
+	}
+}
+
+// imageUnusable returns why an image must not be used for new machines, it is empty if the image is usable
+func imageUnusable(img *models.V1ImageResponse, now time.Time) string {
+	if img.Classification == imageClassificationDeprecated {
+		return "deprecated"
+	}
+	if img.ExpirationDate != nil {
+		expiration := time.Time(*img.ExpirationDate)
+		if !expiration.IsZero() && now.After(expiration) {
+			return fmt.Sprintf("expired since %s", expiration.Format(time.DateOnly))
+		}
+	}
+	return ""
+}
+
+// parseImageReference splits an image reference into the operating system and the version prefix.
+// Leading zeros of the version are allowed, such that ubuntu-24.04 and ubuntu-24.4 are the same reference.
+func parseImageReference(ref string) (string, []uint64) {
+	i := strings.LastIndex(ref, "-")
+	if i < 0 {
+		return ref, nil
+	}
+
+	var prefix []uint64
+	for _, part := range strings.Split(ref[i+1:], ".") {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			// not a version, so the whole reference is the operating system
+			return ref, nil
+		}
+		prefix = append(prefix, n)
+	}
+
+	return ref[:i], prefix
+}
+
+func versionHasPrefix(v *semver.Version, prefix []uint64) bool {
+	parts := []uint64{v.Major(), v.Minor(), v.Patch()}
+	if len(prefix) > len(parts) {
+		return false
+	}
+	for i, n := range prefix {
+		if parts[i] != n {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+)
+
+func Test_latestImage(t *testing.T) {
+	var (
+		now     = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		expired = strfmt.DateTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+		valid   = strfmt.DateTime(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+
+		images = []*models.V1ImageResponse{
+			{ID: pointer.Pointer("ubuntu-22.4.20230101"), ExpirationDate: &expired},
+			{ID: pointer.Pointer("ubuntu-22.4.20240101"), Classification: imageClassificationDeprecated, ExpirationDate: &valid},
+			{ID: pointer.Pointer("ubuntu-24.4.20240101"), Classification: "supported", ExpirationDate: &valid},
+			{ID: pointer.Pointer("ubuntu-24.4.20240315"), Classification: "supported", ExpirationDate: &valid},
+			{ID: pointer.Pointer("ubuntu-24.4.20240415"), Classification: imageClassificationDeprecated, ExpirationDate: &valid},
+			{ID: pointer.Pointer("ubuntu-24.10.20241015"), Classification: imageClassificationPreview},
+			{ID: pointer.Pointer("firewall-ubuntu-3.0.20240315"), Classification: "supported"},
+		}
+	)
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "exact image id",
+			ref:  "ubuntu-24.4.20240101",
+			want: "ubuntu-24.4.20240101",
+		},
+		{
+			name: "latest usable patch version",
+			ref:  "ubuntu-24.4",
+			want: "ubuntu-24.4.20240315",
+		},
+		{
+			name: "leading zeros are allowed",
+			ref:  "ubuntu-24.04",
+			want: "ubuntu-24.4.20240315",
+		},
+		{
+			name: "major version only",
+			ref:  "ubuntu-24",
+			want: "ubuntu-24.4.20240315",
+		},
+		{
+			name: "operating system only",
+			ref:  "ubuntu",
+			want: "ubuntu-24.4.20240315",
+		},
+		{
+			name: "preview image id",
+			ref:  "ubuntu-24.10.20241015",
+			want: "ubuntu-24.10.20241015",
+		},
+		{
+			name:    "preview images are not resolved by version",
+			ref:     "ubuntu-24.10",
+			wantErr: status.Error(codes.InvalidArgument, `no usable image found for "ubuntu-24.10": ubuntu-24.10.20241015 is a preview, which has to be given by its id`),
+		},
+		{
+			name: "operating system containing a dash",
+			ref:  "firewall-ubuntu-3",
+			want: "firewall-ubuntu-3.0.20240315",
+		},
+		{
+			name:    "deprecated image id",
+			ref:     "ubuntu-24.4.20240415",
+			wantErr: status.Error(codes.InvalidArgument, `image "ubuntu-24.4.20240415" is deprecated`),
+		},
+		{
+			name:    "only deprecated and expired images",
+			ref:     "ubuntu-22.04",
+			wantErr: status.Error(codes.InvalidArgument, `no usable image found for "ubuntu-22.04": ubuntu-22.4.20230101 is expired since 2024-05-01, ubuntu-22.4.20240101 is deprecated`),
+		},
+		{
+			name:    "unknown image",
+			ref:     "debian-12",
+			wantErr: status.Error(codes.InvalidArgument, `no image found for "debian-12"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := latestImage(images, tt.ref, now)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
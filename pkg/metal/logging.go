@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"k8s.io/klog/v2"
+)
+
+// The driver operations log with a logger that is attached to the request context and carries the keys below,
+// such that the helpers of an operation log with the same keys through klog.FromContext.
+//
+// The secret of a machine class contains the metal-api credentials and the user data of the machines, which must never
+// be logged. Therefore only the values below, ids and messages of status errors are passed to the logger, but never
+// the secret, the provider spec with its secret data, or any metal-api request.
+
+const (
+	logKeyOperation    = "operation"
+	logKeyMachine      = "machine"
+	logKeyMachineClass = "machineClass"
+	logKeyProviderID   = "providerID"
+	logKeyPartition    = "partition"
+	logKeyProject      = "project"
+	logKeyClusterID    = "clusterID"
+)
+
+// withLogValues returns the logger of the given context with the given key value pairs and a context that carries this logger
+func withLogValues(ctx context.Context, keysAndValues ...any) (context.Context, klog.Logger) {
+	logger := klog.FromContext(ctx).WithValues(keysAndValues...)
+	return klog.NewContext(ctx, logger), logger
+}
+
+// machineLogValues returns the key value pairs of a driver operation on the given machine object
+func machineLogValues(operation string, m *v1alpha1.Machine) []any {
+	return []any{
+		logKeyOperation, operation,
+		logKeyMachine, klog.KObj(m),
+		logKeyProviderID, m.Spec.ProviderID,
+	}
+}
+
+// specLogValues returns the key value pairs of the given provider spec, the cluster id is omitted if empty
+func specLogValues(spec *api.MetalProviderSpec, clusterID string) []any {
+	keysAndValues := []any{
+		logKeyPartition, spec.Partition,
+		logKeyProject, spec.Project,
+	}
+	if clusterID != "" {
+		keysAndValues = append(keysAndValues, logKeyClusterID, clusterID)
+	}
+	return keysAndValues
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/go-logr/logr/funcr"
+	"github.com/google/go-cmp/cmp"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/spi/fake"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+func TestProvider_LogsNoSecrets(t *testing.T) {
+	const (
+		apiKey   = "a-secret-api-key"
+		hmac     = "a-secret-hmac"
+		userData = "#cloud-config\nsecret-user-data"
+	)
+
+	secrets := map[string]*corev1.Secret{
+		"api key": {
+			Data: map[string][]byte{
+				"metalAPIURL": []byte("http://metal-api"),
+				"metalAPIKey": []byte(apiKey),
+				"userData":    []byte(userData),
+			},
+		},
+		"hmac": {
+			Data: map[string][]byte{
+				"metalAPIURL":  []byte("http://metal-api"),
+				"metalAPIHMac": []byte(hmac),
+				"userData":     []byte(userData),
+			},
+		},
+	}
+
+	for name, secret := range secrets {
+		t.Run(name, func(t *testing.T) {
+			var logs strings.Builder
+			ctx := klog.NewContext(context.Background(), funcr.New(func(prefix, args string) {
+				logs.WriteString(prefix + " " + args + "\n")
+			}, funcr.Options{Verbosity: 10}))
+
+			metalAPI := fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithImages(testImages()...)
+			p := &Provider{
+				SPI:     &fake.SPI{MetalAPI: metalAPI},
+				Options: Options{RecoveryAction: RecoveryActionReset, RecoveryTimeout: time.Minute, PowerOffGracePeriod: 1},
+			}
+			class := testMachineClass(t, func(spec *api.MetalProviderSpec) {
+				spec.FallbackSizes = []string{"another-size"}
+			})
+			unhealthy := testMachine("metal:///a-partition/m1")
+			unhealthy.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}
+			another := testMachine("")
+			another.Name, another.UID = "another-machine", "another-uid"
+
+			// the driver operations run through their success and error paths with all log levels enabled
+			_, _ = p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: class, Secret: secret})
+			_, _ = p.GetMachineStatus(ctx, &driver.GetMachineStatusRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: class, Secret: secret})
+			_, _ = p.InitializeMachine(ctx, &driver.InitializeMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: class, Secret: secret})
+			_, _ = p.ListMachines(ctx, &driver.ListMachinesRequest{MachineClass: class, Secret: secret})
+			_, _ = p.DeleteMachine(ctx, &driver.DeleteMachineRequest{Machine: testMachine("metal:///a-partition/m1"), MachineClass: class, Secret: secret})
+			_, _ = p.DeleteMachine(ctx, &driver.DeleteMachineRequest{Machine: unhealthy, MachineClass: class, Secret: secret})
+			_, _ = p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: another, MachineClass: class, Secret: secret})
+
+			// the allocation request contains the user data, so its failure must not log the request
+			metalAPI.WithError("AllocateMachine", fake.HTTPError(http.StatusInternalServerError, "allocation failed"))
+			failed := testMachine("")
+			failed.Name, failed.UID = "failed-machine", "failed-uid"
+			_, err := p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: failed, MachineClass: class, Secret: secret})
+			if diff := cmp.Diff(status.Error(codes.Internal, "a-partition/c1-xlarge-x86: allocation failed"), err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Fatalf("err diff = %s", diff)
+			}
+
+			if logs.Len() == 0 {
+				t.Fatalf("expected the driver operations to log")
+			}
+			for _, s := range []string{apiKey, hmac, "secret-user-data"} {
+				if strings.Contains(logs.String(), s) {
+					t.Errorf("logs contain secret %q:\n%s", s, logs.String())
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_LogsEffectiveProviderSpec(t *testing.T) {
+	var logs strings.Builder
+	ctx := klog.NewContext(context.Background(), funcr.New(func(prefix, args string) {
+		logs.WriteString(prefix + " " + args + "\n")
+	}, funcr.Options{Verbosity: 4}))
+
+	p := &Provider{
+		SPI: &fake.SPI{MetalAPI: fake.NewMetalAPI(fake.NewMachine("m1", testPartition, testSize)).WithImages(testImages()...).WithPartitions(&models.V1PartitionResponse{
+			ID:         pointer.Pointer(testPartition),
+			DNSServers: []*models.V1DNSServer{{IP: pointer.Pointer("1.1.1.1")}},
+		})},
+		Options: Options{PartitionDefaults: true},
+	}
+	class := testMachineClass(t, func(spec *api.MetalProviderSpec) {
+		spec.DNSServers = nil
+	})
+
+	_, err := p.CreateMachine(ctx, &driver.CreateMachineRequest{Machine: testMachine(""), MachineClass: class, Secret: testSecret()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the logged spec is the one the machine is allocated with, including the defaults of the partition
+	for _, s := range []string{`"msg"="effective provider spec"`, `\"dnsServers\":[{\"ip\":\"1.1.1.1\"}]`} {
+		if !strings.Contains(logs.String(), s) {
+			t.Errorf("logs do not contain %s:\n%s", s, logs.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "mcm_provider_metal"
+
+const (
+	operationCreate       = "create"
+	operationDelete       = "delete"
+	operationGet          = "get"
+	operationList         = "list"
+	operationInitialize   = "initialize"
+	operationGetVolumeIDs = "getVolumeIDs"
+)
+
+var (
+	// operationDuration records the duration of the driver operations
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the driver operations in seconds, partitioned by operation, partition, size, project and resulting status code.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"operation", "partition", "size", "project", "code"})
+
+	// operationsTotal counts the driver operations
+	operationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "operations_total",
+		Help:      "Number of driver operations, partitioned by operation, partition, size, project and resulting status code.",
+	}, []string{"operation", "partition", "size", "project", "code"})
+
+	// allocationFailuresTotal counts the failed machine allocations, every tried fallback counts separately
+	allocationFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "allocation_failures_total",
+		Help:      "Number of failed machine allocations, partitioned by partition, size, project and reason.",
+	}, []string{"partition", "size", "project", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(operationDuration)
+	prometheus.MustRegister(operationsTotal)
+	prometheus.MustRegister(allocationFailuresTotal)
+}
+
+// operationMetrics records the duration and the resulting status code of a driver operation
+type operationMetrics struct {
+	operation string
+	start     time.Time
+
+	partition string
+	size      string
+	project   string
+}
+
+func newOperationMetrics(operation string) *operationMetrics {
+	return &operationMetrics{
+		operation: operation,
+		start:     time.Now(),
+	}
+}
+
+// withSpec labels the operation with the partition, size and project of the given provider spec,
+// operations that fail before the provider spec is decoded remain without these labels
+func (o *operationMetrics) withSpec(spec *api.MetalProviderSpec) {
+	o.partition = spec.Partition
+	o.size = spec.Size
+	o.project = spec.Project
+}
+
+// observe records the operation with the status code of the given error
+func (o *operationMetrics) observe(err error) {
+	s, _ := status.FromError(err)
+	labels := prometheus.Labels{
+		"operation": o.operation,
+		"partition": o.partition,
+		"size":      o.size,
+		"project":   o.project,
+		"code":      s.Code().String(),
+	}
+
+	operationDuration.With(labels).Observe(time.Since(o.start).Seconds())
+	operationsTotal.With(labels).Inc()
+}
+
+// observeAllocationFailure counts a failed allocation in the given placement
+func observeAllocationFailure(pl placement, project string, err error) {
+	allocationFailuresTotal.WithLabelValues(pl.partition, pl.size, project, allocationFailureReason(err)).Inc()
+}
+
+// allocationFailureReason returns a reason with a low cardinality for the given allocation error
+func allocationFailureReason(err error) string {
+	s, _ := status.FromError(err)
+	switch s.Code() {
+	case codes.ResourceExhausted:
+		return "no_capacity"
+	case codes.FailedPrecondition:
+		return "no_size_reservation"
+	case codes.InvalidArgument:
+		return "invalid_request"
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return "metal_api_unavailable"
+	default:
+		return "other"
+	}
+}
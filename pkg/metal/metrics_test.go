@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_operationMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{
+			name: "successful operation",
+			code: "OK",
+		},
+		{
+			name: "failed operation",
+			err:  status.Error(codes.ResourceExhausted, "no machine available"),
+			code: "ResourceExhausted",
+		},
+		{
+			name: "error without status code",
+			err:  errors.New("something went wrong"),
+			code: "Unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := operationsTotal.WithLabelValues(operationCreate, "a-partition", "a-size", "a-project", tt.code)
+			before := testutil.ToFloat64(counter)
+
+			metrics := newOperationMetrics(operationCreate)
+			metrics.withSpec(&api.MetalProviderSpec{Partition: "a-partition", Size: "a-size", Project: "a-project"})
+			metrics.observe(tt.err)
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("counted %v operations, want 1", got)
+			}
+		})
+	}
+}
+
+func Test_allocationFailureReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "no capacity",
+			err:  status.Error(codes.ResourceExhausted, "no machine available"),
+			want: "no_capacity",
+		},
+		{
+			name: "no size reservation",
+			err:  status.Error(codes.FailedPrecondition, "project has no size reservation"),
+			want: "no_size_reservation",
+		},
+		{
+			name: "invalid request",
+			err:  status.Error(codes.InvalidArgument, "filesystem layout is not compatible"),
+			want: "invalid_request",
+		},
+		{
+			name: "metal-api unavailable",
+			err:  status.Error(codes.Unavailable, "metal-api is unavailable"),
+			want: "metal_api_unavailable",
+		},
+		{
+			name: "other error",
+			err:  status.Error(codes.Internal, "something went wrong"),
+			want: "other",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allocationFailureReason(tt.err); got != tt.want {
+				t.Errorf("allocationFailureReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// RecoveryAction is the action taken to recover an unhealthy machine
+type RecoveryAction string
+
+const (
+	// RecoveryActionReset resets the machine through its BMC, such that it boots its existing installation again
+	RecoveryActionReset RecoveryAction = "reset"
+	// RecoveryActionReinstall reinstalls the machine with the image it was allocated with
+	RecoveryActionReinstall RecoveryAction = "reinstall"
+)
+
+// Options configure the provider, they are set by controller flags
+type Options struct {
+	// DefaultImage is used for provider specs without an image
+	DefaultImage string
+	// DefaultNetwork is used for provider specs without networks
+	DefaultNetwork string
+	// DefaultSSHKeys are used for provider specs without ssh keys
+	DefaultSSHKeys []string
+	// DefaultDNSServers are used for provider specs without dns servers
+	DefaultDNSServers []string
+	// DefaultNTPServers are used for provider specs without ntp servers
+	DefaultNTPServers []string
+	// PartitionDefaults fills the dns and ntp servers from the partition of the machine
+	// if neither the provider spec nor the controller flags contain them
+	PartitionDefaults bool
+	// CapacityCheck checks for free machines before allocating a machine, such that a missing capacity is reported as resource exhausted
+	CapacityCheck bool
+	// RecoveryAction enables the recovery mode if set. Instead of freeing an unhealthy machine on deletion, the machine
+	// is kept allocated and handed over to the next machine object of the same machine class, which recovers it with this action.
+	// The recovered machine keeps its hostname and user data, so a reinstall requires user data that stays valid.
+	RecoveryAction RecoveryAction
+	// RecoveryConditions are the node condition types that mark a machine as unhealthy for the recovery mode,
+	// a machine is considered unhealthy if the ready condition is not true or any other of these conditions is true.
+	// If empty, only the ready condition is checked.
+	RecoveryConditions []string
+	// RecoveryTimeout is the period a machine released for recovery waits for its adoption by another machine object.
+	// The machine is not listed in the meantime, such that the safety controller frees it only after the timeout.
+	RecoveryTimeout time.Duration
+	// PowerOffGracePeriod enables a graceful power off of machines before they are freed if set.
+	// The machine is freed once it is powered off or the grace period is exceeded.
+	PowerOffGracePeriod time.Duration
+	// WarnUnknownFields only logs unknown and duplicate fields of provider specs as warning instead of rejecting
+	// the creation of machines. Deleting, listing and getting machines never fails on such fields, so that
+	// machines of existing machine classes can always be cleaned up.
+	WarnUnknownFields bool
+	// Timeouts limit the duration of the driver operations including all of their metal-api calls
+	Timeouts Timeouts
+}
+
+// Timeouts are the timeouts of the driver operations, a zero timeout only relies on the deadline of the request context
+type Timeouts struct {
+	Create     time.Duration
+	Delete     time.Duration
+	Get        time.Duration
+	List       time.Duration
+	Initialize time.Duration
+}
+
+// NewOptions returns the default options of the provider
+func NewOptions() Options {
+	return Options{
+		RecoveryTimeout: 10 * time.Minute,
+		Timeouts: Timeouts{
+			Create:     5 * time.Minute,
+			Delete:     2 * time.Minute,
+			Get:        time.Minute,
+			List:       time.Minute,
+			Initialize: time.Minute,
+		},
+	}
+}
+
+// AddFlags adds the flags of the provider to the given flag set
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.DefaultImage, "metal-default-image", o.DefaultImage, "image used for machine classes without an image")
+	fs.StringVar(&o.DefaultNetwork, "metal-default-network", o.DefaultNetwork, "network used for machine classes without networks")
+	fs.StringSliceVar(&o.DefaultSSHKeys, "metal-default-ssh-keys", o.DefaultSSHKeys, "ssh public keys used for machine classes without ssh keys")
+	fs.StringSliceVar(&o.DefaultDNSServers, "metal-default-dns-servers", o.DefaultDNSServers, "dns servers used for machine classes without dns servers")
+	fs.StringSliceVar(&o.DefaultNTPServers, "metal-default-ntp-servers", o.DefaultNTPServers, "ntp servers used for machine classes without ntp servers")
+	fs.BoolVar(&o.CapacityCheck, "metal-capacity-check", o.CapacityCheck, "check the capacity of the partition before allocating a machine")
+	fs.StringVar((*string)(&o.RecoveryAction), "metal-recovery-action", string(o.RecoveryAction), "recover unhealthy machines with this action (reset or reinstall) instead of freeing them, disabled if empty")
+	fs.StringSliceVar(&o.RecoveryConditions, "metal-recovery-conditions", o.RecoveryConditions, "node condition types that mark a machine as unhealthy for the recovery, defaults to Ready")
+	fs.DurationVar(&o.RecoveryTimeout, "metal-recovery-timeout", o.RecoveryTimeout, "period a machine released for recovery waits for its adoption before it is freed")
+	fs.DurationVar(&o.PowerOffGracePeriod, "metal-power-off-grace-period", o.PowerOffGracePeriod, "power off machines before freeing them and wait up to this period for them to turn off, disabled if zero")
+	fs.DurationVar(&o.Timeouts.Create, "metal-create-timeout", o.Timeouts.Create, "timeout of machine creations including all metal-api calls")
+	fs.DurationVar(&o.Timeouts.Delete, "metal-delete-timeout", o.Timeouts.Delete, "timeout of machine deletions including all metal-api calls")
+	fs.DurationVar(&o.Timeouts.Get, "metal-get-timeout", o.Timeouts.Get, "timeout of machine status requests including all metal-api calls")
+	fs.DurationVar(&o.Timeouts.List, "metal-list-timeout", o.Timeouts.List, "timeout of machine listings including all metal-api calls")
+	fs.DurationVar(&o.Timeouts.Initialize, "metal-initialize-timeout", o.Timeouts.Initialize, "timeout of machine initializations including all metal-api calls")
+	fs.BoolVar(&o.PartitionDefaults, "metal-partition-defaults", o.PartitionDefaults, "use the dns and ntp servers of the partition for machine classes without dns or ntp servers")
+	fs.BoolVar(&o.WarnUnknownFields, "metal-warn-unknown-fields", o.WarnUnknownFields, "only log unknown fields of machine classes as warning instead of rejecting the creation of machines")
+}
+
+// Validate returns an error if the options are invalid
+func (o *Options) Validate() error {
+	switch o.RecoveryAction {
+	case "", RecoveryActionReset, RecoveryActionReinstall:
+	default:
+		return fmt.Errorf("unsupported recovery action %q, must be one of %q or %q", o.RecoveryAction, RecoveryActionReset, RecoveryActionReinstall)
+	}
+
+	if o.RecoveryAction == "" && len(o.RecoveryConditions) > 0 {
+		return fmt.Errorf("recovery conditions require a recovery action")
+	}
+
+	if o.RecoveryAction != "" && o.RecoveryTimeout <= 0 {
+		return fmt.Errorf("recovery timeout must be positive")
+	}
+
+	if o.PowerOffGracePeriod < 0 {
+		return fmt.Errorf("power off grace period must not be negative")
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"create":     o.Timeouts.Create,
+		"delete":     o.Timeouts.Delete,
+		"get":        o.Timeouts.Get,
+		"list":       o.Timeouts.List,
+		"initialize": o.Timeouts.Initialize,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("%s timeout must not be negative", name)
+		}
+	}
+
+	return nil
+}
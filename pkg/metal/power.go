@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"github.com/metal-stack/metal-lib/pkg/tag"
+	"k8s.io/klog/v2"
+)
+
+// powerStateOff is the power state the bmc of a machine reports once the machine is turned off
+const powerStateOff = "OFF"
+
+// powerOffMachine powers off the given machine before it is freed and waits up to the grace period for it to turn off.
+// As long as the machine is waiting to turn off, an unavailable status error is returned together with the time the power off was
+// issued. This time is kept in a tag of the machine, as the safety controller deletes orphaned machines without any last known state.
+// No error is returned once the machine can be freed.
+func powerOffMachine(ctx context.Context, m metalgo.Client, mr *models.V1MachineResponse, gracePeriod time.Duration, now time.Time) (time.Time, error) {
+	id := *mr.ID
+
+	resp, err := m.Machine().FindIPMIMachine(machine.NewFindIPMIMachineParamsWithContext(ctx).WithID(id), nil)
+	if err != nil {
+		return time.Time{}, metalErrorToStatus(err)
+	}
+
+	if resp.Payload.Ipmi != nil && pointer.SafeDeref(resp.Payload.Ipmi.Powerstate) == powerStateOff {
+		return time.Time{}, nil
+	}
+
+	var since time.Time
+	if powerOffSince, ok := tag.NewTagMap(mr.Tags).Value(machinePowerOffTagKey); ok {
+		since, _ = time.Parse(time.RFC3339, powerOffSince)
+	}
+
+	if since.IsZero() {
+		_, err := m.Machine().MachineOff(machine.NewMachineOffParamsWithContext(ctx).WithID(id).WithBody(map[string]any{}), nil)
+		if err != nil {
+			return time.Time{}, metalErrorToStatus(err)
+		}
+		// the machine is powered off again on the next call if the tag can not be stored
+		tags := append(slices.Clone(mr.Tags), tag.New(machinePowerOffTagKey, now.UTC().Format(time.RFC3339)))
+		if _, err := updateMachineTags(ctx, m, mr, tags); err != nil {
+			return time.Time{}, err
+		}
+		return now, status.Error(codes.Unavailable, fmt.Sprintf("machine is powering off, waiting up to %s", gracePeriod))
+	}
+
+	waited := now.Sub(since)
+	if waited >= gracePeriod {
+		klog.FromContext(ctx).Info("machine did not power off within the grace period, freeing it anyway", "id", id, "gracePeriod", gracePeriod)
+		return time.Time{}, nil
+	}
+
+	return since, status.Error(codes.Unavailable, fmt.Sprintf("machine is powering off, waiting another %s", (gracePeriod-waited).Round(time.Second)))
+}
@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/google/go-cmp/cmp"
+	"github.com/metal-stack/machine-controller-manager-provider-metal/pkg/spi/fake"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/tag"
+)
+
+// poweringOffMachine returns an allocated machine that was powered off at the given time before it is freed
+func poweringOffMachine(id, since string) *models.V1MachineResponse {
+	m := allocatedMachine(id)
+	m.Tags = append(m.Tags, tag.New(machinePowerOffTagKey, since))
+	return m
+}
+
+func Test_powerOffMachine(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		api              *fake.MetalAPI
+		want             time.Time
+		wantErr          error
+		wantPowerActions []string
+		wantTags         []string
+	}{
+		{
+			name:     "machine is powered off",
+			api:      fake.NewMetalAPI(allocatedMachine("m1")).WithPowerState("m1", "OFF"),
+			want:     time.Time{},
+			wantTags: []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid")},
+		},
+		{
+			name:             "power off machine",
+			api:              fake.NewMetalAPI(allocatedMachine("m1")),
+			want:             now,
+			wantErr:          status.Error(codes.Unavailable, "machine is powering off, waiting up to 5m0s"),
+			wantPowerActions: []string{"off m1"},
+			wantTags:         []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid"), tag.New(machinePowerOffTagKey, "2024-05-01T12:00:00Z")},
+		},
+		{
+			name:     "wait for machine to power off",
+			api:      fake.NewMetalAPI(poweringOffMachine("m1", "2024-05-01T11:58:30Z")),
+			want:     now.Add(-90 * time.Second),
+			wantErr:  status.Error(codes.Unavailable, "machine is powering off, waiting another 3m30s"),
+			wantTags: []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid"), tag.New(machinePowerOffTagKey, "2024-05-01T11:58:30Z")},
+		},
+		{
+			name:     "grace period exceeded",
+			api:      fake.NewMetalAPI(poweringOffMachine("m1", "2024-05-01T11:55:00Z")),
+			want:     time.Time{},
+			wantTags: []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid"), tag.New(machinePowerOffTagKey, "2024-05-01T11:55:00Z")},
+		},
+		{
+			name:     "power off fails",
+			api:      fake.NewMetalAPI(allocatedMachine("m1")).WithError("MachineOff", fake.HTTPError(http.StatusServiceUnavailable, "bmc is unreachable")),
+			want:     time.Time{},
+			wantErr:  status.Error(codes.Unavailable, "bmc is unreachable"),
+			wantTags: []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid")},
+		},
+		{
+			name:             "storing the power off time fails",
+			api:              fake.NewMetalAPI(allocatedMachine("m1")).WithError("UpdateMachine", fake.HTTPError(http.StatusServiceUnavailable, "metal-api is unavailable")),
+			want:             time.Time{},
+			wantErr:          status.Error(codes.Unavailable, "metal-api is unavailable"),
+			wantPowerActions: []string{"off m1"},
+			wantTags:         []string{tag.New(tag.ClusterID, testClusterID), tag.New(machineIdentityTagKey, "a-uid")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := (&fake.SPI{MetalAPI: tt.api}).NewClient(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := powerOffMachine(context.Background(), m, tt.api.Machine("m1"), 5*time.Minute, now)
+
+			if diff := cmp.Diff(tt.wantErr, err, cmp.AllowUnexported(status.Status{})); diff != "" {
+				t.Errorf("err diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantPowerActions, tt.api.PowerActions()); diff != "" {
+				t.Errorf("power actions diff = %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantTags, tt.api.Machine("m1").Tags); diff != "" {
+				t.Errorf("tags diff = %s", diff)
+			}
+		})
+	}
+}
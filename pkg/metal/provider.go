@@ -18,7 +18,8 @@ limitations under the License.
 package provider
 
 import (
-	"strings"
+	"context"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -30,21 +31,26 @@ import (
 // Provider is the struct that implements the driver interface
 // It is used to implement the basic driver functionalities
 type Provider struct {
-	SPI spi.SessionProviderInterface
+	SPI     spi.SessionProviderInterface
+	Options Options
 }
 
 // NewProvider returns an empty provider object
-func NewProvider(spi spi.SessionProviderInterface) driver.Driver {
+func NewProvider(spi spi.SessionProviderInterface, opts Options) driver.Driver {
 	return &Provider{
-		SPI: spi,
+		SPI:     spi,
+		Options: opts,
 	}
 }
 
 func (p *Provider) initClient(secret *corev1.Secret) (metalgo.Client, error) {
-	token := strings.TrimSpace(string(secret.Data["metalAPIKey"]))
-	hmac := strings.TrimSpace(string(secret.Data["metalAPIHMac"]))
-	url := strings.TrimSpace(string(secret.Data["metalAPIURL"]))
+	return p.SPI.NewClient(secret)
+}
 
-	client, err := metalgo.NewDriver(url, token, hmac)
-	return client, err
+// withTimeout returns the context for the metal-api calls of a driver operation, which is canceled after the given timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	"github.com/metal-stack/metal-lib/pkg/tag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The recovery mode works across machine objects: the machine controller always deletes an unhealthy machine object
+// and creates a replacement for it. Instead of freeing the unhealthy machine, it is detached from the deleted machine
+// object and kept allocated in the project. The next creation request of the same machine class adopts it and recovers
+// it in place with the configured action, as freeing the machine would wipe it. The allocation can not be changed,
+// so the recovered machine keeps the hostname and user data it was allocated with, only the name of the adopting
+// machine object is recorded in a tag.
+//
+// A released machine is not listed until the recovery timeout passed, otherwise the safety controller would free it as
+// orphan before it is adopted. Machines that are not adopted within the timeout are listed and freed as orphans. If the
+// safety controller frees a machine while it is adopted, the adoption fails and the next creation request allocates
+// another machine. Deletions of an adopted machine that was listed with the name of its unhealthy machine object before
+// are skipped.
+
+// recoveryRequired returns the unhealthy node conditions of the given machine object that require a recovery
+func recoveryRequired(m *v1alpha1.Machine, conditionTypes []string) []string {
+	if len(conditionTypes) == 0 {
+		conditionTypes = []string{string(corev1.NodeReady)}
+	}
+
+	var unhealthy []string
+	for _, c := range m.Status.Conditions {
+		if !slices.Contains(conditionTypes, string(c.Type)) {
+			continue
+		}
+		if (c.Type == corev1.NodeReady && c.Status != corev1.ConditionTrue) || (c.Type != corev1.NodeReady && c.Status == corev1.ConditionTrue) {
+			unhealthy = append(unhealthy, string(c.Type))
+		}
+	}
+
+	return unhealthy
+}
+
+// recoveryAllowed returns true if the given machine was neither released for recovery nor recovered yet,
+// such that every machine is recovered at most once and freed if it gets unhealthy again
+func recoveryAllowed(mr *models.V1MachineResponse) bool {
+	if mr.Allocation == nil {
+		return false
+	}
+	tm := tag.NewTagMap(mr.Tags)
+	_, released := tm.Value(machineRecoveryTagKey)
+	_, recovered := tm.Value(machineRecoveredTagKey)
+	return !released && !recovered
+}
+
+// recoveryPending returns true if the given machine was released for recovery and can still be adopted by another machine object
+func recoveryPending(mr *models.V1MachineResponse, timeout time.Duration, now time.Time) bool {
+	tm := tag.NewTagMap(mr.Tags)
+	if _, released := tm.Value(machineRecoveryTagKey); !released {
+		return false
+	}
+	releasedAt, ok := tm.Value(machineReleasedTagKey)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, releasedAt)
+	if err != nil {
+		return false
+	}
+	return now.Sub(t) < timeout
+}
+
+// releaseForRecovery detaches the given machine from its machine object, such that it can be adopted by another machine object
+func releaseForRecovery(ctx context.Context, m metalgo.Client, mr *models.V1MachineResponse, action RecoveryAction, now time.Time) (*models.V1MachineResponse, error) {
+	var tags []string
+	for _, t := range mr.Tags {
+		if strings.HasPrefix(t, machineIdentityTagKey+"=") {
+			continue
+		}
+		tags = append(tags, t)
+	}
+	tags = append(tags, tag.New(machineRecoveryTagKey, string(action)), tag.New(machineReleasedTagKey, now.UTC().Format(time.RFC3339)))
+
+	return updateMachineTags(ctx, m, mr, tags)
+}
+
+// findRecoverableMachine returns the first machine released for recovery that was allocated for the given machine class,
+// matches the given placements and did not exceed the recovery timeout or nil if there is no such machine
+func findRecoverableMachine(ctx context.Context, m metalgo.Client, project, clusterIDTag, classTag string, action RecoveryAction, timeout time.Duration, placements []placement, now time.Time) (*models.V1MachineResponse, error) {
+	for _, pl := range placements {
+		mfr := &models.V1MachineFindRequest{
+			AllocationProject: project,
+			PartitionID:       pl.partition,
+			Sizeid:            pl.size,
+			Tags:              []string{tag.New(tag.ClusterID, clusterIDTag), classTag, tag.New(machineRecoveryTagKey, string(action))},
+			AllocationRole:    models.V1MachineAllocationRoleMachine,
+		}
+
+		resp, err := m.Machine().FindMachines(machine.NewFindMachinesParamsWithContext(ctx).WithBody(mfr), nil)
+		if err != nil {
+			return nil, metalErrorToStatus(err)
+		}
+
+		for _, candidate := range resp.Payload {
+			if candidate.ID == nil || candidate.Allocation == nil || candidate.Allocation.Image == nil || candidate.Partition == nil || candidate.Partition.ID == nil {
+				continue
+			}
+			// the safety controller may free the machine at any time once the timeout is exceeded
+			if !recoveryPending(candidate, timeout, now) {
+				continue
+			}
+			return candidate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// recoverMachine runs the recovery action on the given machine while it stays allocated and attaches it
+// to the machine object with the given identity tag and name
+func recoverMachine(ctx context.Context, m metalgo.Client, mr *models.V1MachineResponse, action RecoveryAction, machineTag, machineName string) (*models.V1MachineResponse, error) {
+	var err error
+	switch action {
+	case RecoveryActionReset:
+		// a machine with a hung kernel does not reboot on its own
+		_, err = m.Machine().MachineReset(machine.NewMachineResetParamsWithContext(ctx).WithID(*mr.ID).WithBody(map[string]any{}), nil)
+	case RecoveryActionReinstall:
+		_, err = m.Machine().ReinstallMachine(machine.NewReinstallMachineParamsWithContext(ctx).WithID(*mr.ID).WithBody(&models.V1MachineReinstallRequest{
+			ID:      mr.ID,
+			Imageid: mr.Allocation.Image.ID,
+		}), nil)
+	default:
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unsupported recovery action %q", action))
+	}
+	if err != nil {
+		return nil, metalErrorToStatus(err)
+	}
+
+	// the action is run before the machine is attached, such that a failed attachment retries the action on the next creation request
+	var tags []string
+	for _, t := range mr.Tags {
+		if strings.HasPrefix(t, machineRecoveryTagKey+"=") || strings.HasPrefix(t, machineReleasedTagKey+"=") {
+			continue
+		}
+		tags = append(tags, t)
+	}
+	tags = append(tags, machineTag, tag.New(machineNameTagKey, machineName), tag.New(machineRecoveredTagKey, string(action)))
+
+	return updateMachineTags(ctx, m, mr, tags)
+}
+
+func updateMachineTags(ctx context.Context, m metalgo.Client, mr *models.V1MachineResponse, tags []string) (*models.V1MachineResponse, error) {
+	resp, err := m.Machine().UpdateMachine(machine.NewUpdateMachineParamsWithContext(ctx).WithBody(&models.V1MachineUpdateRequest{
+		ID:          mr.ID,
+		Description: pointer.Pointer(mr.Allocation.Description),
+		SSHPubKeys:  mr.Allocation.SSHPubKeys,
+		Tags:        tags,
+	}), nil)
+	if err != nil {
+		return nil, metalErrorToStatus(err)
+	}
+
+	return resp.Payload, nil
+}
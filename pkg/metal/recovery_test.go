@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/google/go-cmp/cmp"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/tag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_recoveryRequired(t *testing.T) {
+	tests := []struct {
+		name           string
+		conditions     []corev1.NodeCondition
+		conditionTypes []string
+		want           []string
+	}{
+		{
+			name:       "no conditions",
+			conditions: nil,
+			want:       nil,
+		},
+		{
+			name:       "ready node",
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			want:       nil,
+		},
+		{
+			name:       "node not ready",
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}},
+			want:       []string{"Ready"},
+		},
+		{
+			name: "node with unknown state",
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionUnknown},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue},
+			},
+			want: []string{"Ready"},
+		},
+		{
+			name: "problem condition",
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: "KernelDeadlock", Status: corev1.ConditionTrue},
+				{Type: "ReadonlyFilesystem", Status: corev1.ConditionFalse},
+			},
+			conditionTypes: []string{"KernelDeadlock", "ReadonlyFilesystem"},
+			want:           []string{"KernelDeadlock"},
+		},
+		{
+			name:           "ready condition is not selected",
+			conditions:     []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}},
+			conditionTypes: []string{"KernelDeadlock"},
+			want:           nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &v1alpha1.Machine{Status: v1alpha1.MachineStatus{Conditions: tt.conditions}}
+
+			got := recoveryRequired(m, tt.conditionTypes)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
+
+func Test_recoveryPending(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		tags []string
+		want bool
+	}{
+		{
+			name: "not released",
+			tags: []string{tag.New(tag.ClusterID, testClusterID)},
+			want: false,
+		},
+		{
+			name: "released within the timeout",
+			tags: []string{tag.New(machineRecoveryTagKey, "reset"), tag.New(machineReleasedTagKey, "2024-05-01T11:55:00Z")},
+			want: true,
+		},
+		{
+			name: "released before the timeout",
+			tags: []string{tag.New(machineRecoveryTagKey, "reset"), tag.New(machineReleasedTagKey, "2024-05-01T11:50:00Z")},
+			want: false,
+		},
+		{
+			name: "release time missing",
+			tags: []string{tag.New(machineRecoveryTagKey, "reset")},
+			want: false,
+		},
+		{
+			name: "invalid release time",
+			tags: []string{tag.New(machineRecoveryTagKey, "reset"), tag.New(machineReleasedTagKey, "yesterday")},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recoveryPending(&models.V1MachineResponse{Tags: tt.tags}, 10*time.Minute, now)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diff = %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	api "github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal/apis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/metal-stack/machine-controller-manager-provider-metal/pkg/metal")
+
+const (
+	machineNameAttributeKey      = attribute.Key("machine.name")
+	machineClassNameAttributeKey = attribute.Key("machine.class.name")
+	providerIDAttributeKey       = attribute.Key("machine.provider_id")
+	partitionAttributeKey        = attribute.Key("metal.partition")
+	sizeAttributeKey             = attribute.Key("metal.size")
+	projectAttributeKey          = attribute.Key("metal.project")
+	statusCodeAttributeKey       = attribute.Key("machine.status_code")
+)
+
+// startSpan starts the span of a driver operation, the metal-api calls of the operation become its children
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends the span of a driver operation with the status code of the given error
+func endSpan(span trace.Span, err error) {
+	s, _ := status.FromError(err)
+	span.SetAttributes(statusCodeAttributeKey.String(s.Code().String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, s.Message())
+	}
+	span.End()
+}
+
+func machineAttributes(m *v1alpha1.Machine) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		machineNameAttributeKey.String(m.Name),
+		providerIDAttributeKey.String(m.Spec.ProviderID),
+	}
+}
+
+func specAttributes(spec *api.MetalProviderSpec) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		partitionAttributeKey.String(spec.Partition),
+		sizeAttributeKey.String(spec.Size),
+		projectAttributeKey.String(spec.Project),
+	}
+}
@@ -0,0 +1,129 @@
+package spi
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	metalgo "github.com/metal-stack/metal-go"
+	apiclient "github.com/metal-stack/metal-go/api/client"
+	"github.com/metal-stack/metal-go/api/client/audit"
+	"github.com/metal-stack/metal-go/api/client/filesystemlayout"
+	"github.com/metal-stack/metal-go/api/client/firewall"
+	"github.com/metal-stack/metal-go/api/client/firmware"
+	"github.com/metal-stack/metal-go/api/client/health"
+	"github.com/metal-stack/metal-go/api/client/image"
+	"github.com/metal-stack/metal-go/api/client/ip"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/client/network"
+	"github.com/metal-stack/metal-go/api/client/partition"
+	"github.com/metal-stack/metal-go/api/client/project"
+	"github.com/metal-stack/metal-go/api/client/size"
+	"github.com/metal-stack/metal-go/api/client/sizeimageconstraint"
+	"github.com/metal-stack/metal-go/api/client/switch_operations"
+	"github.com/metal-stack/metal-go/api/client/tenant"
+	"github.com/metal-stack/metal-go/api/client/user"
+	"github.com/metal-stack/metal-go/api/client/version"
+	"github.com/metal-stack/metal-go/api/client/vpn"
+	"github.com/metal-stack/security"
+)
+
+// hmacAuthType is the hmac auth type metal-go uses by default
+const hmacAuthType = "Metal-Admin"
+
+// client is a metal-go client that sends its calls through a retry transport, traces them and records their durations.
+// It authenticates in the same way as the client returned by metalgo.NewDriver.
+type client struct {
+	c *apiclient.MetalAPI
+}
+
+func newClient(rawURL, token, hmac string, policy RetryPolicy) (metalgo.Client, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid url:%s, must be in the form scheme://host[:port]/basepath", rawURL)
+	}
+
+	transport := httptransport.New(parsedURL.Host, parsedURL.Path, []string{parsedURL.Scheme})
+	transport.Transport = &statusRecorder{next: transport.Transport}
+
+	switch {
+	case hmac != "":
+		auth := security.NewHMACAuth(hmacAuthType, []byte(hmac))
+		transport.DefaultAuthentication = runtime.ClientAuthInfoWriterFunc(func(rq runtime.ClientRequest, _ strfmt.Registry) error {
+			auth.AddAuthToClientRequest(rq, time.Now())
+			return nil
+		})
+	case token != "":
+		transport.DefaultAuthentication = runtime.ClientAuthInfoWriterFunc(func(rq runtime.ClientRequest, _ strfmt.Registry) error {
+			security.AddUserTokenToClientRequest(rq, token)
+			return nil
+		})
+	}
+
+	// every retry is traced and measured separately
+	var next runtime.ClientTransport = &metricsTransport{next: transport}
+	next = &tracingTransport{next: next, host: parsedURL.Host}
+
+	return &client{c: apiclient.New(newRetryTransport(next, policy), strfmt.Default)}, nil
+}
+
+func (c *client) Audit() audit.ClientService {
+	return c.c.Audit
+}
+func (c *client) Filesystemlayout() filesystemlayout.ClientService {
+	return c.c.Filesystemlayout
+}
+func (c *client) Firewall() firewall.ClientService {
+	return c.c.Firewall
+}
+func (c *client) Firmware() firmware.ClientService {
+	return c.c.Firmware
+}
+func (c *client) Health() health.ClientService {
+	return c.c.Health
+}
+func (c *client) Image() image.ClientService {
+	return c.c.Image
+}
+func (c *client) IP() ip.ClientService {
+	return c.c.IP
+}
+func (c *client) Machine() machine.ClientService {
+	return c.c.Machine
+}
+func (c *client) Network() network.ClientService {
+	return c.c.Network
+}
+func (c *client) Partition() partition.ClientService {
+	return c.c.Partition
+}
+func (c *client) Project() project.ClientService {
+	return c.c.Project
+}
+func (c *client) Size() size.ClientService {
+	return c.c.Size
+}
+func (c *client) Sizeimageconstraint() sizeimageconstraint.ClientService {
+	return c.c.Sizeimageconstraint
+}
+func (c *client) SwitchOperations() switch_operations.ClientService {
+	return c.c.SwitchOperations
+}
+func (c *client) Tenant() tenant.ClientService {
+	return c.c.Tenant
+}
+func (c *client) User() user.ClientService {
+	return c.c.User
+}
+func (c *client) Version() version.ClientService {
+	return c.c.Version
+}
+func (c *client) VPN() vpn.ClientService {
+	return c.c.Vpn
+}
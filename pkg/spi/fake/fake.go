@@ -0,0 +1,651 @@
+// Package fake contains an in-memory metal-api implementation to be used in unit tests
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/go-openapi/runtime"
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/client/filesystemlayout"
+	"github.com/metal-stack/metal-go/api/client/image"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/client/partition"
+	"github.com/metal-stack/metal-go/api/client/size"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/httperrors"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SPI is a session provider that returns clients for an in-memory metal-api
+type SPI struct {
+	MetalAPI *MetalAPI
+	// Err is returned on client creation if set
+	Err error
+}
+
+// NewClient returns a client for the in-memory metal-api
+func (s *SPI) NewClient(_ *corev1.Secret) (metalgo.Client, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return &client{api: s.MetalAPI}, nil
+}
+
+// MetalAPI is an in-memory metal-api that holds machines, filesystem layouts, images, networks, partitions and size reservations.
+// Only the endpoints used by the provider are implemented, all others panic.
+type MetalAPI struct {
+	mutex sync.Mutex
+
+	machines          []*models.V1MachineResponse
+	filesystemLayouts []*models.V1FilesystemLayoutResponse
+	images            []*models.V1ImageResponse
+	networks          []*models.V1NetworkResponse
+	partitions        []*models.V1PartitionResponse
+	sizeReservations  []*models.V1SizeReservationResponse
+	powerStates       map[string]string
+	powerActions      []string
+	errs              map[string]error
+}
+
+// NewMetalAPI returns an in-memory metal-api containing the given machines
+func NewMetalAPI(machines ...*models.V1MachineResponse) *MetalAPI {
+	return &MetalAPI{
+		machines:    machines,
+		powerStates: map[string]string{},
+		errs:        map[string]error{},
+	}
+}
+
+// WithFilesystemLayouts adds filesystem layouts to the metal-api
+func (a *MetalAPI) WithFilesystemLayouts(fsls ...*models.V1FilesystemLayoutResponse) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.filesystemLayouts = append(a.filesystemLayouts, fsls...)
+	return a
+}
+
+// WithImages adds images to the metal-api
+func (a *MetalAPI) WithImages(images ...*models.V1ImageResponse) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.images = append(a.images, images...)
+	return a
+}
+
+// WithNetworks adds networks to the metal-api, allocations with a network of another partition are rejected
+func (a *MetalAPI) WithNetworks(networks ...*models.V1NetworkResponse) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.networks = append(a.networks, networks...)
+	return a
+}
+
+// WithPartitions adds partitions to the metal-api
+func (a *MetalAPI) WithPartitions(partitions ...*models.V1PartitionResponse) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.partitions = append(a.partitions, partitions...)
+	return a
+}
+
+// WithSizeReservations adds size reservations to the metal-api
+func (a *MetalAPI) WithSizeReservations(reservations ...*models.V1SizeReservationResponse) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.sizeReservations = append(a.sizeReservations, reservations...)
+	return a
+}
+
+// WithError makes the given operation (e.g. "AllocateMachine") fail with the given error
+func (a *MetalAPI) WithError(operation string, err error) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.errs[operation] = err
+	return a
+}
+
+// Machine returns the machine with the given id
+func (a *MetalAPI) Machine(id string) *models.V1MachineResponse {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.machine(id)
+}
+
+// Machines returns all machines
+func (a *MetalAPI) Machines() []*models.V1MachineResponse {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return slices.Clone(a.machines)
+}
+
+// WithPowerState sets the power state the bmc of the machine with the given id reports, machines are powered on by default
+func (a *MetalAPI) WithPowerState(id, state string) *MetalAPI {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.powerStates[id] = state
+	return a
+}
+
+// PowerActions returns the power actions sent to machines in the order of the requests, e.g. "reset m1"
+func (a *MetalAPI) PowerActions() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return slices.Clone(a.powerActions)
+}
+
+// err returns the error configured for the given operation or the error of the request context, as metal-go does not
+// send requests whose context is already done
+func (a *MetalAPI) err(ctx context.Context, operation string) error {
+	if err := a.errs[operation]; err != nil {
+		return err
+	}
+	if ctx != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (a *MetalAPI) machine(id string) *models.V1MachineResponse {
+	for _, m := range a.machines {
+		if pointer.SafeDeref(m.ID) == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// NewMachine returns an unallocated machine of the given size in the given partition
+func NewMachine(id, partition, size string) *models.V1MachineResponse {
+	return &models.V1MachineResponse{
+		ID:        pointer.Pointer(id),
+		Partition: &models.V1PartitionResponse{ID: pointer.Pointer(partition)},
+		Size:      &models.V1SizeResponse{ID: pointer.Pointer(size)},
+	}
+}
+
+// HTTPError returns an error of the form metal-go returns for erroneous responses of the metal-api
+func HTTPError(code int, format string, args ...any) error {
+	resp := machine.NewFindMachineDefault(code)
+	resp.Payload = &httperrors.HTTPErrorResponse{
+		StatusCode: code,
+		Message:    fmt.Sprintf(format, args...),
+	}
+	return resp
+}
+
+type client struct {
+	metalgo.Client
+	api *MetalAPI
+}
+
+func (c *client) Machine() machine.ClientService {
+	return &machineClient{api: c.api}
+}
+
+func (c *client) Filesystemlayout() filesystemlayout.ClientService {
+	return &filesystemLayoutClient{api: c.api}
+}
+
+func (c *client) Image() image.ClientService {
+	return &imageClient{api: c.api}
+}
+
+func (c *client) Partition() partition.ClientService {
+	return &partitionClient{api: c.api}
+}
+
+func (c *client) Size() size.ClientService {
+	return &sizeClient{api: c.api}
+}
+
+type machineClient struct {
+	machine.ClientService
+	api *MetalAPI
+}
+
+func (c *machineClient) AllocateMachine(params *machine.AllocateMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.AllocateMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "AllocateMachine"); err != nil {
+		return nil, err
+	}
+
+	req := params.Body
+
+	for _, n := range req.Networks {
+		for _, nw := range a.networks {
+			if pointer.SafeDeref(nw.ID) == pointer.SafeDeref(n.Networkid) && nw.Partitionid != "" && nw.Partitionid != pointer.SafeDeref(req.Partitionid) {
+				return nil, HTTPError(http.StatusUnprocessableEntity, "network %s is not in partition %s", pointer.SafeDeref(n.Networkid), pointer.SafeDeref(req.Partitionid))
+			}
+		}
+	}
+
+	var candidate *models.V1MachineResponse
+	for _, m := range a.machines {
+		if m.Allocation != nil {
+			continue
+		}
+		if req.UUID != "" && pointer.SafeDeref(m.ID) != req.UUID {
+			continue
+		}
+		if pointer.SafeDeref(m.Partition.ID) != pointer.SafeDeref(req.Partitionid) || pointer.SafeDeref(m.Size.ID) != pointer.SafeDeref(req.Sizeid) {
+			continue
+		}
+		candidate = m
+		break
+	}
+
+	if candidate == nil {
+		if req.UUID != "" && a.machine(req.UUID) == nil {
+			return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", req.UUID)
+		}
+		if req.UUID != "" {
+			return nil, HTTPError(http.StatusUnprocessableEntity, "machine %s is not available", req.UUID)
+		}
+		return nil, HTTPError(http.StatusUnprocessableEntity, "no machine available")
+	}
+
+	var networks []*models.V1MachineNetwork
+	for _, n := range req.Networks {
+		networks = append(networks, &models.V1MachineNetwork{Networkid: n.Networkid})
+	}
+
+	candidate.Tags = slices.Clone(req.Tags)
+	candidate.Allocation = &models.V1MachineAllocation{
+		Name:        pointer.Pointer(req.Name),
+		Hostname:    pointer.Pointer(req.Hostname),
+		Description: req.Description,
+		Project:     req.Projectid,
+		Role:        pointer.Pointer(models.V1MachineAllocationRoleMachine),
+		Image:       &models.V1ImageResponse{ID: req.Imageid},
+		UserData:    req.UserData,
+		SSHPubKeys:  req.SSHPubKeys,
+		Networks:    networks,
+		DNSServers:  req.DNSServers,
+		NtpServers:  req.NtpServers,
+	}
+	if req.Filesystemlayoutid != "" {
+		candidate.Allocation.Filesystemlayout = &models.V1FilesystemLayoutResponse{ID: pointer.Pointer(req.Filesystemlayoutid)}
+	}
+
+	return &machine.AllocateMachineOK{Payload: candidate}, nil
+}
+
+func (c *machineClient) FindMachine(params *machine.FindMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.FindMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "FindMachine"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+
+	return &machine.FindMachineOK{Payload: m}, nil
+}
+
+func (c *machineClient) FindMachines(params *machine.FindMachinesParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.FindMachinesOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "FindMachines"); err != nil {
+		return nil, err
+	}
+
+	req := params.Body
+
+	result := []*models.V1MachineResponse{}
+	for _, m := range a.machines {
+		if req.ID != "" && pointer.SafeDeref(m.ID) != req.ID {
+			continue
+		}
+		if req.PartitionID != "" && pointer.SafeDeref(m.Partition.ID) != req.PartitionID {
+			continue
+		}
+		if req.Sizeid != "" && pointer.SafeDeref(m.Size.ID) != req.Sizeid {
+			continue
+		}
+		if req.AllocationProject != "" && (m.Allocation == nil || pointer.SafeDeref(m.Allocation.Project) != req.AllocationProject) {
+			continue
+		}
+		if req.AllocationRole != "" && (m.Allocation == nil || pointer.SafeDeref(m.Allocation.Role) != req.AllocationRole) {
+			continue
+		}
+		if !containsAll(m.Tags, req.Tags) {
+			continue
+		}
+		result = append(result, m)
+	}
+
+	return &machine.FindMachinesOK{Payload: result}, nil
+}
+
+func (c *machineClient) FreeMachine(params *machine.FreeMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.FreeMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "FreeMachine"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+
+	m.Allocation = nil
+	m.Tags = nil
+
+	return &machine.FreeMachineOK{Payload: m}, nil
+}
+
+func (c *machineClient) UpdateMachine(params *machine.UpdateMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.UpdateMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "UpdateMachine"); err != nil {
+		return nil, err
+	}
+
+	req := params.Body
+
+	m := a.machine(pointer.SafeDeref(req.ID))
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", pointer.SafeDeref(req.ID))
+	}
+	if m.Allocation == nil {
+		return nil, HTTPError(http.StatusUnprocessableEntity, "machine %s is not allocated", pointer.SafeDeref(req.ID))
+	}
+
+	m.Tags = slices.Clone(req.Tags)
+	m.Allocation.Description = pointer.SafeDeref(req.Description)
+	m.Allocation.SSHPubKeys = req.SSHPubKeys
+
+	return &machine.UpdateMachineOK{Payload: m}, nil
+}
+
+func (c *machineClient) MachineReset(params *machine.MachineResetParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.MachineResetOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "MachineReset"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+
+	a.powerActions = append(a.powerActions, "reset "+params.ID)
+
+	return &machine.MachineResetOK{Payload: m}, nil
+}
+
+func (c *machineClient) MachineOff(params *machine.MachineOffParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.MachineOffOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "MachineOff"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+
+	// the machine keeps its power state, as a real machine takes a while to turn off
+	a.powerActions = append(a.powerActions, "off "+params.ID)
+
+	return &machine.MachineOffOK{Payload: m}, nil
+}
+
+func (c *machineClient) FindIPMIMachine(params *machine.FindIPMIMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.FindIPMIMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "FindIPMIMachine"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+
+	powerState, ok := a.powerStates[params.ID]
+	if !ok {
+		powerState = "ON"
+	}
+
+	return &machine.FindIPMIMachineOK{Payload: &models.V1MachineIPMIResponse{
+		ID:         m.ID,
+		Allocation: m.Allocation,
+		Partition:  m.Partition,
+		Size:       m.Size,
+		Events:     m.Events,
+		Tags:       m.Tags,
+		Ipmi:       &models.V1MachineIPMI{Powerstate: pointer.Pointer(powerState)},
+	}}, nil
+}
+
+func (c *machineClient) ReinstallMachine(params *machine.ReinstallMachineParams, _ runtime.ClientAuthInfoWriter, _ ...machine.ClientOption) (*machine.ReinstallMachineOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "ReinstallMachine"); err != nil {
+		return nil, err
+	}
+
+	m := a.machine(params.ID)
+	if m == nil {
+		return nil, HTTPError(http.StatusNotFound, "machine %s does not exist", params.ID)
+	}
+	if m.Allocation == nil {
+		return nil, HTTPError(http.StatusUnprocessableEntity, "machine %s is not allocated", params.ID)
+	}
+
+	// a reinstalled machine provisions again, so its events start over
+	m.Allocation.Image = &models.V1ImageResponse{ID: params.Body.Imageid}
+	m.Events = nil
+
+	return &machine.ReinstallMachineOK{Payload: m}, nil
+}
+
+type filesystemLayoutClient struct {
+	filesystemlayout.ClientService
+	api *MetalAPI
+}
+
+func (c *filesystemLayoutClient) GetFilesystemLayout(params *filesystemlayout.GetFilesystemLayoutParams, _ runtime.ClientAuthInfoWriter, _ ...filesystemlayout.ClientOption) (*filesystemlayout.GetFilesystemLayoutOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "GetFilesystemLayout"); err != nil {
+		return nil, err
+	}
+
+	for _, fsl := range a.filesystemLayouts {
+		if pointer.SafeDeref(fsl.ID) == params.ID {
+			return &filesystemlayout.GetFilesystemLayoutOK{Payload: fsl}, nil
+		}
+	}
+
+	return nil, HTTPError(http.StatusNotFound, "filesystemlayout %s does not exist", params.ID)
+}
+
+type imageClient struct {
+	image.ClientService
+	api *MetalAPI
+}
+
+func (c *imageClient) ListImages(params *image.ListImagesParams, _ runtime.ClientAuthInfoWriter, _ ...image.ClientOption) (*image.ListImagesOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "ListImages"); err != nil {
+		return nil, err
+	}
+
+	return &image.ListImagesOK{Payload: slices.Clone(a.images)}, nil
+}
+
+type partitionClient struct {
+	partition.ClientService
+	api *MetalAPI
+}
+
+func (c *partitionClient) FindPartition(params *partition.FindPartitionParams, _ runtime.ClientAuthInfoWriter, _ ...partition.ClientOption) (*partition.FindPartitionOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "FindPartition"); err != nil {
+		return nil, err
+	}
+
+	for _, p := range a.partitions {
+		if pointer.SafeDeref(p.ID) == params.ID {
+			return &partition.FindPartitionOK{Payload: p}, nil
+		}
+	}
+
+	return nil, HTTPError(http.StatusNotFound, "partition %s does not exist", params.ID)
+}
+
+func (c *partitionClient) PartitionCapacity(params *partition.PartitionCapacityParams, _ runtime.ClientAuthInfoWriter, _ ...partition.ClientOption) (*partition.PartitionCapacityOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "PartitionCapacity"); err != nil {
+		return nil, err
+	}
+
+	req := params.Body
+
+	capacities := map[string]*models.V1PartitionCapacity{}
+	servers := map[string]*models.V1ServerCapacity{}
+	for _, m := range a.machines {
+		partitionID, sizeID := pointer.SafeDeref(m.Partition.ID), pointer.SafeDeref(m.Size.ID)
+		if req.ID != "" && partitionID != req.ID {
+			continue
+		}
+		if req.Sizeid != "" && sizeID != req.Sizeid {
+			continue
+		}
+
+		pc, ok := capacities[partitionID]
+		if !ok {
+			pc = &models.V1PartitionCapacity{ID: pointer.Pointer(partitionID)}
+			capacities[partitionID] = pc
+		}
+		sc, ok := servers[partitionID+"/"+sizeID]
+		if !ok {
+			sc = &models.V1ServerCapacity{Size: pointer.Pointer(sizeID)}
+			servers[partitionID+"/"+sizeID] = sc
+			pc.Servers = append(pc.Servers, sc)
+		}
+
+		sc.Total++
+		if m.Allocation != nil {
+			sc.Allocated++
+		} else {
+			sc.Free++
+			sc.Allocatable++
+		}
+	}
+
+	var result []*models.V1PartitionCapacity
+	for _, pc := range capacities {
+		result = append(result, pc)
+	}
+
+	return &partition.PartitionCapacityOK{Payload: result}, nil
+}
+
+type sizeClient struct {
+	size.ClientService
+	api *MetalAPI
+}
+
+func (c *sizeClient) SizeReservationsUsage(params *size.SizeReservationsUsageParams, _ runtime.ClientAuthInfoWriter, _ ...size.ClientOption) (*size.SizeReservationsUsageOK, error) {
+	a := c.api
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.err(params.Context, "SizeReservationsUsage"); err != nil {
+		return nil, err
+	}
+
+	req := params.Body
+
+	result := []*models.V1SizeReservationUsageResponse{}
+	for _, r := range a.sizeReservations {
+		projectID, sizeID := pointer.SafeDeref(r.Projectid), pointer.SafeDeref(r.Sizeid)
+		if req.Projectid != "" && projectID != req.Projectid {
+			continue
+		}
+		if req.Sizeid != "" && sizeID != req.Sizeid {
+			continue
+		}
+
+		for _, partitionID := range r.Partitionids {
+			if req.Partitionid != "" && partitionID != req.Partitionid {
+				continue
+			}
+
+			var allocations int32
+			for _, m := range a.machines {
+				if m.Allocation == nil || pointer.SafeDeref(m.Allocation.Project) != projectID {
+					continue
+				}
+				if pointer.SafeDeref(m.Partition.ID) == partitionID && pointer.SafeDeref(m.Size.ID) == sizeID {
+					allocations++
+				}
+			}
+
+			result = append(result, &models.V1SizeReservationUsageResponse{
+				ID:                 r.ID,
+				Amount:             r.Amount,
+				Partitionid:        pointer.Pointer(partitionID),
+				Projectid:          r.Projectid,
+				Sizeid:             r.Sizeid,
+				Projectallocations: pointer.Pointer(allocations),
+				Usedamount:         pointer.Pointer(min(allocations, pointer.SafeDeref(r.Amount))),
+			})
+		}
+	}
+
+	return &size.SizeReservationsUsageOK{Payload: result}, nil
+}
+
+func containsAll(tags, required []string) bool {
+	for _, t := range required {
+		if !slices.Contains(tags, t) {
+			return false
+		}
+	}
+	return true
+}
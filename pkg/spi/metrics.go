@@ -0,0 +1,45 @@
+package spi
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestDuration records the duration of every metal-api call, retries are recorded separately
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "mcm_provider_metal",
+	Subsystem: "metal_api",
+	Name:      "request_duration_seconds",
+	Help:      "Duration of the metal-api calls in seconds, partitioned by endpoint and response status code.",
+	Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+}, []string{"endpoint", "code"})
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+// metricsTransport records the duration of the metal-api calls per endpoint, which is the operation id of the call
+type metricsTransport struct {
+	next runtime.ClientTransport
+}
+
+// Submit implements runtime.ClientTransport
+func (t *metricsTransport) Submit(op *runtime.ClientOperation) (any, error) {
+	start := time.Now()
+	result, err := t.next.Submit(op)
+
+	// calls without a response, e.g. because of connection errors or timeouts, are recorded with the code "none"
+	code := "none"
+	if op.Context != nil {
+		if rs, ok := op.Context.Value(responseStatusKey{}).(*responseStatus); ok && rs.code != 0 {
+			code = strconv.Itoa(rs.code)
+		}
+	}
+
+	requestDuration.WithLabelValues(op.ID, code).Observe(time.Since(start).Seconds())
+
+	return result, err
+}
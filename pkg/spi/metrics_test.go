@@ -0,0 +1,42 @@
+package spi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func sampleCount(t *testing.T, endpoint, code string) uint64 {
+	var m dto.Metric
+	if err := requestDuration.WithLabelValues(endpoint, code).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsTransport(t *testing.T) {
+	s, _ := metalAPI(t, http.StatusServiceUnavailable)
+
+	c, err := newClient(s.URL, "a-token", "", testPolicy())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unavailable, ok := sampleCount(t, "findMachine", "503"), sampleCount(t, "findMachine", "200")
+
+	_, err = c.Machine().FindMachine(machine.NewFindMachineParams().WithID("m1"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// every retry is recorded with its own status code
+	if got := sampleCount(t, "findMachine", "503") - unavailable; got != 1 {
+		t.Errorf("recorded %d calls with status 503, want 1", got)
+	}
+	if got := sampleCount(t, "findMachine", "200") - ok; got != 1 {
+		t.Errorf("recorded %d calls with status 200, want 1", got)
+	}
+}
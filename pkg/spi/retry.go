@@ -0,0 +1,297 @@
+package spi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/go-openapi/runtime"
+	"github.com/spf13/pflag"
+)
+
+// RetryPolicy configures the retries of idempotent metal-api calls and the circuit breaker around the metal-api client
+type RetryPolicy struct {
+	// MaxRetries is the maximum amount of retries of an idempotent call, zero disables retries
+	MaxRetries int
+	// InitialBackoff is the backoff before the first retry, it doubles with every further retry
+	InitialBackoff time.Duration
+	// MaxBackoff limits the backoff between two retries
+	MaxBackoff time.Duration
+	// FailureThreshold is the amount of consecutive failed calls after which the circuit opens, zero disables the circuit breaker
+	FailureThreshold int
+	// OpenDuration is the duration the circuit stays open until a single call is let through to probe the metal-api
+	OpenDuration time.Duration
+}
+
+// DefaultRetryPolicy returns the default retry policy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:       3,
+		InitialBackoff:   200 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+	}
+}
+
+// AddFlags adds the flags of the retry policy to the given flag set
+func (r *RetryPolicy) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&r.MaxRetries, "metal-api-max-retries", r.MaxRetries, "maximum amount of retries of idempotent metal-api calls that failed with a transient error")
+	fs.DurationVar(&r.InitialBackoff, "metal-api-initial-backoff", r.InitialBackoff, "backoff before the first retry of a metal-api call, doubled with every further retry")
+	fs.DurationVar(&r.MaxBackoff, "metal-api-max-backoff", r.MaxBackoff, "maximum backoff between two retries of a metal-api call")
+	fs.IntVar(&r.FailureThreshold, "metal-api-failure-threshold", r.FailureThreshold, "consecutive failed metal-api calls after which no further calls are sent for the open duration, disabled if zero")
+	fs.DurationVar(&r.OpenDuration, "metal-api-open-duration", r.OpenDuration, "duration no metal-api calls are sent after the failure threshold was reached")
+}
+
+// backoff returns the jittered exponential backoff before the given retry, starting with zero
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	d := r.InitialBackoff
+	for range retry {
+		d *= 2
+		if d >= r.MaxBackoff {
+			d = r.MaxBackoff
+			break
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	// the jitter spreads the retries of concurrent calls, such that a recovering metal-api is not hit by all of them at once
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryTransport retries idempotent metal-api calls that failed with a transient error and stops sending calls
+// for a while if the metal-api keeps failing. Non-idempotent calls like machine allocations are never retried.
+type retryTransport struct {
+	next    runtime.ClientTransport
+	policy  RetryPolicy
+	breaker *circuitBreaker
+}
+
+func newRetryTransport(next runtime.ClientTransport, policy RetryPolicy) *retryTransport {
+	t := &retryTransport{
+		next:   next,
+		policy: policy,
+	}
+	if policy.FailureThreshold > 0 {
+		t.breaker = &circuitBreaker{
+			threshold:    policy.FailureThreshold,
+			openDuration: policy.OpenDuration,
+			now:          time.Now,
+		}
+	}
+	return t
+}
+
+// Submit implements runtime.ClientTransport
+func (t *retryTransport) Submit(op *runtime.ClientOperation) (any, error) {
+	ctx := op.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	rs := &responseStatus{}
+	op.Context = context.WithValue(ctx, responseStatusKey{}, rs)
+
+	retries := 0
+	if idempotent(op) {
+		retries = t.policy.MaxRetries
+	}
+
+	for retry := 0; ; retry++ {
+		if err := t.breaker.allow(); err != nil {
+			return nil, err
+		}
+
+		rs.code = 0
+		result, err := t.next.Submit(op)
+
+		switch {
+		case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+			// the caller gave up, which says nothing about the availability of the metal-api
+			t.breaker.release()
+			return result, err
+		case err == nil || !transient(err, rs.code):
+			t.breaker.success()
+			return result, err
+		}
+
+		t.breaker.failure()
+
+		if retry >= retries {
+			return result, unavailable(err, rs.code)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(t.policy.backoff(retry)):
+		}
+	}
+}
+
+// idempotent returns true for metal-api calls that only read data and can therefore be sent again
+func idempotent(op *runtime.ClientOperation) bool {
+	if op.Method == http.MethodGet {
+		return true
+	}
+	// searches are sent as post requests with the query in the body
+	if strings.HasPrefix(op.ID, "find") {
+		return true
+	}
+	switch op.ID {
+	case "partitionCapacity", "sizeReservationsUsage":
+		return true
+	}
+	return false
+}
+
+// transient returns true if the given error of a call that received a response with the given status code
+// is caused by a temporary unavailability of the metal-api, e.g. during a rolling update of the metal-api
+func transient(err error, code int) bool {
+	if code != 0 {
+		return transientStatus(code)
+	}
+
+	var (
+		defaultResponse interface{ Code() int }
+		apiErr          *runtime.APIError
+		netErr          net.Error
+	)
+
+	switch {
+	case errors.As(err, &defaultResponse):
+		return transientStatus(defaultResponse.Code())
+	case errors.As(err, &apiErr):
+		return transientStatus(apiErr.Code)
+	case errors.As(err, &netErr):
+		return true
+	default:
+		return false
+	}
+}
+
+// unavailable returns an unavailable status error for a transient error whose status code can not be determined
+// from the error itself, which is the case if the response body could not be decoded, e.g. for error pages of a load balancer
+func unavailable(err error, code int) error {
+	var defaultResponse interface{ Code() int }
+	if code == 0 || errors.As(err, &defaultResponse) {
+		return err
+	}
+	return status.Error(codes.Unavailable, fmt.Sprintf("metal-api responded with status %d: %v", code, err))
+}
+
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// circuitBreaker opens after a threshold of consecutive transient failures and rejects all calls until the open duration
+// is over. Afterwards a single call is let through, which closes the circuit again if it succeeds.
+type circuitBreaker struct {
+	mutex        sync.Mutex
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns an unavailable status error if the circuit is open
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+
+	if b.probing || b.now().Sub(b.openedAt) < b.openDuration {
+		return status.Error(codes.Unavailable, fmt.Sprintf("metal-api is unavailable, not sending any calls after %d consecutive failures", b.failures))
+	}
+
+	b.probing = true
+	return nil
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+	b.failures = 0
+	b.openedAt = time.Time{}
+}
+
+// failure opens the circuit once the threshold of consecutive failures is reached
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// release lets another call probe the metal-api without changing the state of the circuit
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+}
+
+// responseStatus holds the status code of the last response of a metal-api call
+type responseStatus struct {
+	code int
+}
+
+type responseStatusKey struct{}
+
+// statusRecorder records the status code of a response in the response status of the request context,
+// as the errors returned by metal-go do not contain it if the response body could not be decoded
+type statusRecorder struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (s *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := s.next.RoundTrip(req)
+	if rs, ok := req.Context().Value(responseStatusKey{}).(*responseStatus); ok && res != nil {
+		rs.code = res.StatusCode
+	}
+	return res, err
+}
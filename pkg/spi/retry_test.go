@@ -0,0 +1,229 @@
+package spi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/pointer"
+)
+
+// metalAPI returns a metal-api server that responds with the given status codes in order and with 200 afterwards,
+// the returned counter contains the amount of received requests
+func metalAPI(t *testing.T, codes ...int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+			_, _ = w.Write([]byte(`{"statuscode":503,"message":"metal-api is restarting"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/machine/find":
+			_, _ = w.Write([]byte(`[{"id":"m1"}]`))
+		default:
+			_, _ = w.Write([]byte(`{"id":"m1"}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func testPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetryTransport_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []int
+		call         func(c machine.ClientService) error
+		wantErr      bool
+		wantCode     codes.Code
+		wantRequests int32
+	}{
+		{
+			name:  "retry get request",
+			codes: []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			call: func(c machine.ClientService) error {
+				_, err := c.FindMachine(machine.NewFindMachineParams().WithID("m1"), nil)
+				return err
+			},
+			wantRequests: 3,
+		},
+		{
+			name:  "retry search request",
+			codes: []int{http.StatusServiceUnavailable},
+			call: func(c machine.ClientService) error {
+				_, err := c.FindMachines(machine.NewFindMachinesParams().WithBody(&models.V1MachineFindRequest{ID: "m1"}), nil)
+				return err
+			},
+			wantRequests: 2,
+		},
+		{
+			name:  "give up after max retries",
+			codes: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			call: func(c machine.ClientService) error {
+				_, err := c.FindMachine(machine.NewFindMachineParams().WithID("m1"), nil)
+				return err
+			},
+			wantErr:      true,
+			wantCode:     codes.Unavailable,
+			wantRequests: 4,
+		},
+		{
+			name:  "do not retry permanent errors",
+			codes: []int{http.StatusNotFound},
+			call: func(c machine.ClientService) error {
+				_, err := c.FindMachine(machine.NewFindMachineParams().WithID("m1"), nil)
+				return err
+			},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:  "never retry allocations",
+			codes: []int{http.StatusServiceUnavailable},
+			call: func(c machine.ClientService) error {
+				_, err := c.AllocateMachine(machine.NewAllocateMachineParams().WithBody(&models.V1MachineAllocateRequest{
+					Name:        "a-machine",
+					Projectid:   pointer.Pointer("a-project"),
+					Partitionid: pointer.Pointer("a-partition"),
+					Sizeid:      pointer.Pointer("a-size"),
+					Imageid:     pointer.Pointer("an-image"),
+				}), nil)
+				return err
+			},
+			wantErr:      true,
+			wantCode:     codes.Unavailable,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, requests := metalAPI(t, tt.codes...)
+
+			c, err := newClient(s.URL, "a-token", "", testPolicy())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = tt.call(c.Machine())
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if s, ok := status.FromError(err); tt.wantCode != 0 && (!ok || s.Code() != tt.wantCode) {
+				t.Errorf("err = %v, want code %s", err, tt.wantCode)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_Context(t *testing.T) {
+	s, requests := metalAPI(t, http.StatusServiceUnavailable)
+
+	policy := testPolicy()
+	policy.InitialBackoff = time.Hour
+	policy.MaxBackoff = time.Hour
+
+	c, err := newClient(s.URL, "a-token", "", policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.Machine().FindMachine(machine.NewFindMachineParamsWithContext(ctx).WithID("m1"), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the backoff to end with the request context, got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestRetryTransport_CircuitBreaker(t *testing.T) {
+	s, requests := metalAPI(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	policy := RetryPolicy{FailureThreshold: 2, OpenDuration: time.Minute}
+
+	c, err := newClient(s.URL, "a-token", "", policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Now()
+	c.(*client).c.Transport.(*retryTransport).breaker.now = func() time.Time { return now }
+
+	find := func() error {
+		_, err := c.Machine().FindMachine(machine.NewFindMachineParams().WithID("m1"), nil)
+		return err
+	}
+
+	for range 2 {
+		if err := find(); err == nil {
+			t.Fatalf("expected the call to fail")
+		}
+	}
+
+	wantErr := status.Error(codes.Unavailable, "metal-api is unavailable, not sending any calls after 2 consecutive failures")
+	if err := find(); err == nil || err.Error() != wantErr.Error() {
+		t.Errorf("expected the circuit to be open, got %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// the probe after the open duration fails and opens the circuit again
+	now = now.Add(time.Minute)
+	if err := find(); err == nil {
+		t.Fatalf("expected the probe to fail")
+	}
+	wantErr = status.Error(codes.Unavailable, "metal-api is unavailable, not sending any calls after 3 consecutive failures")
+	if err := find(); err == nil || err.Error() != wantErr.Error() {
+		t.Errorf("expected the circuit to be open again, got %v", err)
+	}
+
+	// a successful probe closes the circuit
+	now = now.Add(time.Minute)
+	for range 2 {
+		if err := find(); err != nil {
+			t.Errorf("expected the circuit to be closed, got %v", err)
+		}
+	}
+	if got := requests.Load(); got != 5 {
+		t.Errorf("requests = %d, want 5", got)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for retry, upper := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for range 10 {
+			got := policy.backoff(retry)
+			if got < upper/2 || got > upper {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", retry, got, upper/2, upper)
+			}
+		}
+	}
+}
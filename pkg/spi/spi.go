@@ -16,12 +16,67 @@ limitations under the License.
 
 package spi
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	metalgo "github.com/metal-stack/metal-go"
+	corev1 "k8s.io/api/core/v1"
+)
+
 // SessionProviderInterface provides an interface to deal with cloud provider session
-// Example interfaces are listed below.
 type SessionProviderInterface interface {
-	// NewSession(*corev1.Secret, string) (*session.Session, error)
-	// NewEC2API(*session.Session) ec2iface.EC2API
+	// NewClient returns a metal-api client for the credentials contained in the given secret
+	NewClient(*corev1.Secret) (metalgo.Client, error)
 }
 
 // PluginSPIImpl is the real implementation of SPI interface that makes the calls to the provider SDK.
-type PluginSPIImpl struct{}
+// Clients are cached per metal-api url and credentials, as the machine controller passes secrets without name
+// and namespace, such that a new client is created when the secret content changes.
+type PluginSPIImpl struct {
+	// RetryPolicy configures the retries and the circuit breaker of the clients
+	RetryPolicy RetryPolicy
+
+	mutex   sync.Mutex
+	clients map[string]metalgo.Client
+}
+
+// NewClient returns a cached metal-api client for the given secret or creates a new one
+func (p *PluginSPIImpl) NewClient(secret *corev1.Secret) (metalgo.Client, error) {
+	var (
+		token = strings.TrimSpace(string(secret.Data["metalAPIKey"]))
+		hmac  = strings.TrimSpace(string(secret.Data["metalAPIHMac"]))
+		url   = strings.TrimSpace(string(secret.Data["metalAPIURL"]))
+		key   = credentialsHash(url, token, hmac)
+	)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := newClient(url, token, hmac, p.RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.clients == nil {
+		p.clients = map[string]metalgo.Client{}
+	}
+	p.clients[key] = client
+
+	return client, nil
+}
+
+func credentialsHash(url, token, hmac string) string {
+	h := sha256.New()
+	for _, s := range []string{url, token, hmac} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
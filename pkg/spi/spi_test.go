@@ -0,0 +1,81 @@
+package spi
+
+import (
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPluginSPIImpl_NewClient(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "metal", Namespace: "shoot--test"},
+		Data: map[string][]byte{
+			"metalAPIURL": []byte("http://metal-api:8080/metal"),
+			"metalAPIKey": []byte("a-token"),
+		},
+	}
+
+	p := &PluginSPIImpl{}
+
+	first, err := p.NewClient(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := p.NewClient(secret)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if c != first {
+				t.Errorf("expected cached client to be returned")
+			}
+		}()
+	}
+	wg.Wait()
+
+	rotated := secret.DeepCopy()
+	rotated.Data["metalAPIKey"] = []byte("another-token")
+
+	second, err := p.NewClient(rotated)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second == first {
+		t.Errorf("expected a new client after the secret content changed")
+	}
+
+	// the machine controller passes secrets without name and namespace
+	unnamed := &corev1.Secret{Data: secret.Data}
+	unnamedRotated := &corev1.Secret{Data: rotated.Data}
+
+	for range 2 {
+		c, err := p.NewClient(unnamed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c != first {
+			t.Errorf("expected the client of the same credentials to be shared")
+		}
+		c, err = p.NewClient(unnamedRotated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c != second {
+			t.Errorf("expected the client of the same credentials to be shared")
+		}
+	}
+
+	invalid := secret.DeepCopy()
+	invalid.Data["metalAPIURL"] = []byte("metal-api")
+
+	if _, err := p.NewClient(invalid); err == nil {
+		t.Errorf("expected an error for an invalid url")
+	}
+}
@@ -0,0 +1,66 @@
+package spi
+
+import (
+	"context"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/metal-stack/machine-controller-manager-provider-metal/pkg/spi")
+
+// tracingTransport starts a span for every metal-api call as a child of the span in the context of the call
+// and propagates the trace context to the metal-api in the request headers
+type tracingTransport struct {
+	next runtime.ClientTransport
+	host string
+}
+
+// Submit implements runtime.ClientTransport
+func (t *tracingTransport) Submit(op *runtime.ClientOperation) (any, error) {
+	parent, params := op.Context, op.Params
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, span := tracer.Start(parent, op.ID, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(op.Method),
+		semconv.HTTPRoute(op.PathPattern),
+		semconv.ServerAddress(t.host),
+	))
+	defer span.End()
+
+	// the same operation is submitted again on retries, which must not become children of this call
+	defer func() {
+		op.Context, op.Params = parent, params
+	}()
+
+	op.Context = ctx
+	op.Params = runtime.ClientRequestWriterFunc(func(req runtime.ClientRequest, reg strfmt.Registry) error {
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		for k, v := range carrier {
+			if err := req.SetHeaderParam(k, v); err != nil {
+				return err
+			}
+		}
+		return params.WriteToRequest(req, reg)
+	})
+
+	result, err := t.next.Submit(op)
+
+	if rs, ok := ctx.Value(responseStatusKey{}).(*responseStatus); ok && rs.code != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rs.code))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+
+	return result, err
+}
@@ -0,0 +1,75 @@
+package spi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/metal-stack/metal-go/api/client/machine"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparents []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		w.Header().Set("Content-Type", "application/json")
+		if len(traceparents) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"m1"}`))
+	}))
+	defer s.Close()
+
+	c, err := newClient(s.URL, "a-token", "", testPolicy())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "CreateMachine")
+	_, err = c.Machine().FindMachine(machine.NewFindMachineParamsWithContext(ctx).WithID("m1"), nil)
+	parent.End()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want 3", len(spans))
+	}
+
+	// every retry is a child of the calling span and propagated to the metal-api
+	for i, span := range spans[:2] {
+		if span.Name() != "findMachine" {
+			t.Errorf("span %d is named %q, want findMachine", i, span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d is not a child of the calling span", i)
+		}
+		want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+		if traceparents[i] != want {
+			t.Errorf("traceparent of request %d = %q, want %q", i, traceparents[i], want)
+		}
+	}
+
+	for i, want := range []int64{http.StatusServiceUnavailable, http.StatusOK} {
+		var got int64
+		for _, a := range spans[i].Attributes() {
+			if a.Key == "http.response.status_code" {
+				got = a.Value.AsInt64()
+			}
+		}
+		if got != want {
+			t.Errorf("span %d has status code %d, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package tracing sets up the export of the traces of the driver operations and the metal-api calls
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	// ExporterOTLP exports the traces to an otlp collector over grpc
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes the traces to stdout, which is meant for debugging
+	ExporterStdout = "stdout"
+)
+
+// serviceName is the name of the service the traces of the provider are reported with
+const serviceName = "machine-controller-manager-provider-metal"
+
+// Options configure the tracing, they are set by controller flags
+type Options struct {
+	// Exporter enables the tracing if set and is either otlp or stdout
+	Exporter string
+	// OTLPEndpoint is the host and port of the otlp collector, if empty the endpoint is taken from the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable and defaults to localhost:4317
+	OTLPEndpoint string
+	// OTLPInsecure disables the transport security of the connection to the otlp collector
+	OTLPInsecure bool
+	// SampleRatio is the ratio of the sampled traces, which only applies to traces that are not started by the machine controller manager
+	SampleRatio float64
+}
+
+// NewOptions returns the default options of the tracing
+func NewOptions() Options {
+	return Options{
+		SampleRatio: 1,
+	}
+}
+
+// AddFlags adds the flags of the tracing to the given flag set
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Exporter, "tracing-exporter", o.Exporter, "exporter of the traces of driver operations and metal-api calls (otlp or stdout), disabled if empty")
+	fs.StringVar(&o.OTLPEndpoint, "tracing-otlp-endpoint", o.OTLPEndpoint, "host and port of the otlp collector, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable")
+	fs.BoolVar(&o.OTLPInsecure, "tracing-otlp-insecure", o.OTLPInsecure, "connect to the otlp collector without transport security")
+	fs.Float64Var(&o.SampleRatio, "tracing-sample-ratio", o.SampleRatio, "ratio of sampled traces between 0 and 1")
+}
+
+// Validate returns an error if the options are invalid
+func (o *Options) Validate() error {
+	switch o.Exporter {
+	case "", ExporterOTLP, ExporterStdout:
+	default:
+		return fmt.Errorf("unsupported tracing exporter %q, must be one of %q or %q", o.Exporter, ExporterOTLP, ExporterStdout)
+	}
+
+	if o.SampleRatio < 0 || o.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Start registers a global tracer provider that exports the traces with the configured exporter and a propagator for the
+// w3c trace context. The returned function flushes the remaining traces and has to be called before the controller exits.
+func (o *Options) Start(ctx context.Context) (func(context.Context) error, error) {
+	if o.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch o.Exporter {
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if o.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(o.OTLPEndpoint))
+		}
+		if o.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		err = fmt.Errorf("unsupported tracing exporter %q", o.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create tracing exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown, nil
+}